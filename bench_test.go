@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// keywordMap is the map lookupKeyword replaced. It is kept so the two can
+// be benchmarked against each other; to compare them end to end, point
+// readKeyword at lookupKeywordMap and rerun BenchmarkParseCondition.
+var keywordMap = map[string]Token{
+	"AND":    AND,
+	"OR":     OR,
+	"NOT":    NOT,
+	"EXISTS": EXISTS,
+	"IN":     IN,
+	"true":   BOOLEAN,
+	"false":  BOOLEAN,
+	"null":   NULL,
+}
+
+func lookupKeywordMap(word string) (Token, bool) {
+	tok, ok := keywordMap[word]
+	return tok, ok
+}
+
+// benchWords mixes keywords with the field names that make up most bare
+// words in real conditions.
+var benchWords = strings.Fields("AND OR NOT EXISTS IN true false null service status duration_ms http.method trace.parent_id user.role region error")
+
+func TestLookupKeywordMatchesMap(t *testing.T) {
+	for _, word := range benchWords {
+		tok, ok := lookupKeyword(word)
+		mtok, mok := lookupKeywordMap(word)
+		if tok != mtok && ok || ok != mok {
+			t.Errorf("lookupKeyword(%q) = %v, %v; the map gives %v, %v", word, tok, ok, mtok, mok)
+		}
+	}
+}
+
+func BenchmarkLookupKeyword(b *testing.B) {
+	impls := []struct {
+		name   string
+		lookup func(string) (Token, bool)
+	}{
+		{"switch", lookupKeyword},
+		{"map", lookupKeywordMap},
+	}
+	for _, impl := range impls {
+		b.Run(impl.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for _, word := range benchWords {
+					impl.lookup(word)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkParseCondition parses a long condition made mostly of bare
+// words, each of which goes through the keyword lookup.
+func BenchmarkParseCondition(b *testing.B) {
+	clause := `(service = "api" AND status >= 500 AND NOT EXISTS(trace.parent_id) AND region IN ("us-east-1", "eu-west-1"))`
+	var sb strings.Builder
+	sb.WriteString(clause)
+	for sb.Len() < 4096 {
+		sb.WriteString(" OR " + clause)
+	}
+	input := "(" + sb.String() + ")"
+	if _, err := ParseCondition(input); err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(input)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ParseCondition(input)
+	}
+}
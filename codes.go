@@ -0,0 +1,71 @@
+package main
+
+// Every diagnostic has a stable code that identifies its kind independently
+// of the message text, so it can be matched or suppressed by tools. Codes
+// are never reused or renumbered: a retired kind keeps its code reserved,
+// and new kinds take the next free number in their range. HL0xx codes are
+// errors and HL1xx codes are warnings.
+
+// Lexer errors.
+const (
+	codeUnexpectedCharacter  = "HL001"
+	codeMissingFieldName     = "HL002"
+	codeWildcardNotAllowed   = "HL003"
+	codeInvalidWildcard      = "HL004"
+	codeInvalidFieldChar     = "HL005"
+	codePlaceholder          = "HL006"
+	codeUnterminatedTemplate = "HL007"
+	codeInvalidNumber        = "HL008"
+	codeUnknownUnit          = "HL009"
+	codeAmbiguousComma       = "HL010"
+	codeUnterminatedString   = "HL011"
+	codeUnterminatedQuoted   = "HL012"
+	codeEmptyQuotedField     = "HL013"
+)
+
+// Structural errors.
+const (
+	codeEmptyCondition      = "HL020"
+	codeDanglingConnective  = "HL021"
+	codeBareField           = "HL022"
+	codeNotWithoutCondition = "HL023"
+	codeMismatchedParens    = "HL024"
+	codeRegexWithoutField   = "HL025"
+	codeSpaceInFieldName    = "HL026"
+	codePostfixCall         = "HL027"
+	codeCallOnGroup         = "HL028"
+	codeOrderedBoolean      = "HL029"
+	codeMalformedIn         = "HL030"
+	codeExistsConstant      = "HL031"
+	codeExistsWithoutField  = "HL032"
+	codeExistsComparison    = "HL033"
+	codeCoalesceOperand     = "HL034"
+	codeMalformedList       = "HL035"
+	codeNumericString       = "HL036"
+	codeOperatorAfterParen  = "HL037"
+	codeMissingOperand      = "HL038"
+	codeCommentNotTrailing  = "HL039"
+	codeUnexpectedComma     = "HL040"
+	codeMissingConnective   = "HL041"
+	codeEmptyGroup          = "HL042"
+	codeUnknownFunction     = "HL043"
+	codeTooFewArguments     = "HL044"
+	codeBareLiteral         = "HL045"
+)
+
+// ruleCodes maps each warning rule to its code.
+var ruleCodes = map[string]string{
+	"in-list-length":       "HL101",
+	"double-negation":      "HL102",
+	"existence-style":      "HL103",
+	"constant-comparison":  "HL104",
+	"no-field":             "HL105",
+	"field-type-conflict":  "HL106",
+	"unanchored-regex":     "HL107",
+	"regex-operand-type":   "HL108",
+	"quoted-field-spacing": "HL109",
+	"max-length":           "HL110",
+	"negated-field":        "HL111",
+	"in-list-types":        "HL112",
+	"numeric-string":       "HL113",
+}
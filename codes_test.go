@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// codeConstants returns the value of every code* constant in codes.go.
+func codeConstants(t *testing.T) map[string]string {
+	t.Helper()
+	f, err := parser.ParseFile(token.NewFileSet(), "codes.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	consts := make(map[string]string)
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			vs := spec.(*ast.ValueSpec)
+			for i, name := range vs.Names {
+				if !strings.HasPrefix(name.Name, "code") {
+					continue
+				}
+				value, err := strconv.Unquote(vs.Values[i].(*ast.BasicLit).Value)
+				if err != nil {
+					t.Fatal(err)
+				}
+				consts[name.Name] = value
+			}
+		}
+	}
+	return consts
+}
+
+// warningRules returns the rule name of every Warning built in lint.go.
+func warningRules(t *testing.T) []string {
+	t.Helper()
+	f, err := parser.ParseFile(token.NewFileSet(), "lint.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rules []string
+	ast.Inspect(f, func(n ast.Node) bool {
+		kv, ok := n.(*ast.KeyValueExpr)
+		if !ok {
+			return true
+		}
+		key, ok := kv.Key.(*ast.Ident)
+		lit, isLit := kv.Value.(*ast.BasicLit)
+		if ok && isLit && key.Name == "Rule" {
+			rule, err := strconv.Unquote(lit.Value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rules = append(rules, rule)
+		}
+		return true
+	})
+	if len(rules) == 0 {
+		t.Fatal("found no warning rules in lint.go")
+	}
+	return rules
+}
+
+func TestCodesAreUnique(t *testing.T) {
+	seen := make(map[string]string)
+	check := func(name, code string) {
+		if !strings.HasPrefix(code, "HL") || len(code) != 5 {
+			t.Errorf("%s has malformed code %q", name, code)
+		}
+		if other, ok := seen[code]; ok {
+			t.Errorf("%s and %s share code %s", name, other, code)
+		}
+		seen[code] = name
+	}
+	consts := codeConstants(t)
+	if len(consts) == 0 {
+		t.Fatal("found no code constants in codes.go")
+	}
+	for name, code := range consts {
+		if code >= "HL100" {
+			t.Errorf("error %s has warning code %s", name, code)
+		}
+		check(name, code)
+	}
+	for rule, code := range ruleCodes {
+		if code < "HL100" {
+			t.Errorf("rule %s has error code %s", rule, code)
+		}
+		check(rule, code)
+	}
+	for _, rule := range warningRules(t) {
+		if ruleCodes[rule] == "" {
+			t.Errorf("rule %s has no code", rule)
+		}
+	}
+}
+
+// Codes are matched and suppressed by users, so a known kind of problem
+// must keep its code.
+func TestCodesAreStable(t *testing.T) {
+	errorTests := []struct {
+		condition string
+		code      string
+	}{
+		{`$a = @`, "HL001"},
+		{`$a = "x`, "HL011"},
+		{``, "HL020"},
+		{`$status`, "HL022"},
+		{`$a = 1, $b = 2`, "HL040"},
+		{`EXISTS(5)`, "HL031"},
+		{`$a =`, "HL038"},
+		{`$a = 1 2`, "HL041"},
+		{`()`, "HL042"},
+		{`FOO($a)`, "HL043"},
+		{`LENGTH()`, "HL044"},
+		{`5`, "HL045"},
+	}
+	for _, tt := range errorTests {
+		_, err := ParseCondition(tt.condition)
+		var ve *ValidationError
+		if !errors.As(err, &ve) {
+			t.Errorf("ParseCondition(%q) = %v, want a ValidationError", tt.condition, err)
+			continue
+		}
+		if ve.Code != tt.code {
+			t.Errorf("ParseCondition(%q) has code %s, want %s", tt.condition, ve.Code, tt.code)
+		}
+	}
+
+	warningTests := []struct {
+		condition string
+		rule      string
+		code      string
+	}{
+		{`NOT NOT $a = 1`, "double-negation", "HL102"},
+		{`1 = 1`, "constant-comparison", "HL104"},
+	}
+	for _, tt := range warningTests {
+		res, err := Lint(tt.condition)
+		if err != nil {
+			t.Errorf("Lint(%q): %v", tt.condition, err)
+			continue
+		}
+		found := false
+		for _, w := range res.Warnings {
+			if w.Rule == tt.rule {
+				found = true
+				if w.Code != tt.code {
+					t.Errorf("Lint(%q): %s has code %s, want %s", tt.condition, w.Rule, w.Code, tt.code)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("Lint(%q) did not report %s", tt.condition, tt.rule)
+		}
+	}
+}
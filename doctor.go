@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// doctorSamples are conditions with a known outcome, run by the doctor
+// subcommand to check that an installed binary behaves as expected.
+var doctorSamples = []struct {
+	condition string
+	valid     bool
+}{
+	{`$status = 200`, true},
+	{`$http.method != "GET" AND $duration_ms >= 100.5`, true},
+	{`NOT EXISTS($error)`, true},
+	{`$status IN (500, 502, 503)`, true},
+	{`IN($region, "us-east-1", "eu-west-1")`, true},
+	{`$user.role IN $admin_roles`, true},
+	{"$`service name` = \"api\"", true},
+	{`true`, true},
+	{``, false},
+	{`$status`, false},
+	{`$service name = "api"`, false},
+	{`$a = "unterminated`, false},
+	{`$flag > true`, false},
+	{`$x IN 1`, false},
+	{`EXISTS(5)`, false},
+}
+
+// runDoctor validates the doctor samples, prints a line per sample and
+// returns a non-zero exit code if any of them behaved unexpectedly.
+func runDoctor(w io.Writer) int {
+	failed := 0
+	for _, s := range doctorSamples {
+		_, err := ParseCondition(s.condition)
+		switch {
+		case s.valid && err != nil:
+			fmt.Fprintf(w, "FAIL %q: expected valid, got: %v\n", s.condition, err)
+			failed++
+		case !s.valid && err == nil:
+			fmt.Fprintf(w, "FAIL %q: expected an error\n", s.condition)
+			failed++
+		default:
+			fmt.Fprintf(w, "PASS %q\n", s.condition)
+		}
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(w, "%d of %d checks failed\n", failed, len(doctorSamples))
+		return 1
+	}
+	fmt.Fprintf(w, "All %d checks passed\n", len(doctorSamples))
+	return 0
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDoctor(t *testing.T) {
+	var out bytes.Buffer
+	if code := runDoctor(&out); code != 0 {
+		t.Fatalf("doctor = %d:\n%s", code, out.String())
+	}
+	if strings.Contains(out.String(), "FAIL") {
+		t.Errorf("doctor reported a failure:\n%s", out.String())
+	}
+	if want := fmt.Sprintf("All %d checks passed\n", len(doctorSamples)); !strings.HasSuffix(out.String(), want) {
+		t.Errorf("doctor output does not end with %q:\n%s", want, out.String())
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/hasantayyar/honeylint
+
+go 1.18
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// inputConfig describes how conditions are laid out in an input file.
+type inputConfig struct {
+	format string // "text", "csv", "tsv" or "markdown"
+	column string // CSV column holding conditions: a header name, or a 1-based index without a header
+	header bool   // whether the first CSV row is a header
+	decode string // encoding of each condition: "" or "base64"
+}
+
+// entry is a single condition read from an input file.
+type entry struct {
+	location  string // where in the file the condition came from; empty for text input
+	condition string
+	line      int   // 1-based line in the file where the condition starts
+	column    int   // 1-based column in the file where the condition starts
+	quoted    bool  // written as a quoted CSV field, with each '"' doubled
+	escaped   bool  // written as a JSON string with escapes
+	err       error // why the row could not be read; the condition is then empty
+}
+
+// readEntries reads the conditions in path according to in.
+func readEntries(path string, in inputConfig) ([]entry, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch in.format {
+	case "", "text":
+		return []entry{{condition: string(data), line: 1, column: 1}}, nil
+	case "csv":
+		return readCSV(data, ',', in)
+	case "tsv":
+		return readCSV(data, '\t', in)
+	case "markdown":
+		return readMarkdown(data)
+	case "json":
+		return readJSONArray(data)
+	default:
+		return nil, fmt.Errorf("unknown input format %q", in.format)
+	}
+}
+
+// readCSV returns the condition column of every data row. Rows are numbered
+// the way a spreadsheet shows them, so the header, if any, is row 1. A row
+// that cannot be read, or has no condition column, becomes an entry with
+// its error, so that the other rows are still validated.
+func readCSV(data []byte, comma rune, in inputConfig) ([]entry, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comma = comma
+	r.FieldsPerRecord = -1 // rows may be ragged; only the condition column matters
+	var records [][]string
+	var starts [][][2]int // line and column of each field
+	var errs []error
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		var pe *csv.ParseError
+		if errors.As(err, &pe) {
+			records = append(records, nil)
+			starts = append(starts, [][2]int{{pe.StartLine, 1}})
+			errs = append(errs, err)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		fields := make([][2]int, len(record))
+		for j := range record {
+			fields[j][0], fields[j][1] = r.FieldPos(j)
+		}
+		records = append(records, record)
+		starts = append(starts, fields)
+		errs = append(errs, nil)
+	}
+	lines := bytes.Split(data, []byte("\n"))
+	col := -1
+	first := 0
+	if in.header {
+		if len(records) == 0 {
+			return nil, fmt.Errorf("missing header row")
+		}
+		if errs[0] != nil {
+			return nil, errs[0]
+		}
+		for i, name := range records[0] {
+			if name == in.column {
+				col = i
+			}
+		}
+		if col < 0 {
+			return nil, fmt.Errorf("no column named %q in header", in.column)
+		}
+		first = 1
+	} else {
+		n, err := strconv.Atoi(in.column)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("--column must be a 1-based column number when there is no header, got %q", in.column)
+		}
+		col = n - 1
+	}
+
+	var entries []entry
+	for i := first; i < len(records); i++ {
+		location := fmt.Sprintf("row %d", i+1)
+		if errs[i] == nil && col >= len(records[i]) {
+			errs[i] = fmt.Errorf("row %d has no column %d", i+1, col+1)
+		}
+		if errs[i] != nil {
+			entries = append(entries, entry{location: location, line: starts[i][0][0], column: 1, err: errs[i]})
+			continue
+		}
+		line, column := starts[i][col][0], starts[i][col][1]
+		quoted := false
+		if l := lines[line-1]; column <= len(l) && l[column-1] == '"' {
+			column++ // the condition starts after the opening quote
+			quoted = true
+		}
+		entries = append(entries, entry{
+			location:  location,
+			condition: records[i][col],
+			line:      line,
+			column:    column,
+			quoted:    quoted,
+		})
+	}
+	return entries, nil
+}
+
+// readJSONArray returns the elements of a JSON array of condition strings,
+// the form filters store implicitly AND-ed conditions in. Elements are
+// numbered by their 0-based index. An element that is not a string becomes
+// an entry with its error, so that the other elements are still validated.
+func readJSONArray(data []byte) ([]entry, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return nil, fmt.Errorf("expected a JSON array of conditions")
+	}
+	var entries []entry
+	for i := 0; dec.More(); i++ {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %v", err)
+		}
+		line, column, _ := locate(string(data), int(dec.InputOffset())-len(raw))
+		e := entry{location: fmt.Sprintf("index %d", i), line: line, column: column}
+		var typeErr *json.UnmarshalTypeError
+		if err := json.Unmarshal(raw, &e.condition); errors.As(err, &typeErr) {
+			e.err = fmt.Errorf("expected a condition string, got %s", typeErr.Value)
+		} else {
+			e.column++ // the condition starts after the opening quote
+			e.escaped = bytes.IndexByte(raw, '\\') >= 0
+		}
+		entries = append(entries, e)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+	return entries, nil
+}
+
+// readMarkdown returns the contents of the fenced code blocks tagged
+// honeycomb, with the line number of each block's opening fence. Other
+// fenced blocks are skipped.
+func readMarkdown(data []byte) ([]entry, error) {
+	var entries []entry
+	var block []string
+	fence := "" // closing fence of the block being read, if any
+	inside := false
+	start := 0
+	for i, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if fence == "" {
+			if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+				fence = trimmed[:3]
+				inside = strings.TrimSpace(trimmed[3:]) == "honeycomb"
+				block = nil
+				start = i + 1
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, fence) && strings.TrimSpace(trimmed[len(fence):]) == "" {
+			if inside {
+				entries = append(entries, entry{
+					location:  fmt.Sprintf("line %d", start),
+					condition: strings.Join(block, "\n"),
+					line:      start + 1,
+					column:    1,
+				})
+			}
+			fence = ""
+			continue
+		}
+		block = append(block, line)
+	}
+	if fence != "" && inside {
+		return nil, fmt.Errorf("unterminated code block starting on line %d", start)
+	}
+	return entries, nil
+}
+
+// decodeCondition undoes the encoding some export tools apply to conditions
+// to avoid escaping problems. Error offsets refer to the decoded text.
+func decodeCondition(condition string, in inputConfig) (string, error) {
+	switch in.decode {
+	case "":
+		return condition, nil
+	case "base64":
+		data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(condition))
+		if err != nil {
+			return "", fmt.Errorf("condition is not valid base64: %v", err)
+		}
+		return string(data), nil
+	default:
+		return "", fmt.Errorf("unknown encoding %q", in.decode)
+	}
+}
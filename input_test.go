@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestCSV(t *testing.T) {
+	csv := writeFile(t, "defs.csv", "name,condition\nok,$status = 200\nbroken,\"$a = \"\"x\"\" AND\"\n")
+	tsv := writeFile(t, "defs.tsv", "ok\t$status = 200\nbroken\t$a =\n")
+	ragged := writeFile(t, "ragged.csv", "name,condition\na,$a = 1\nb\nc,$c =\nd,$d = \"x\"\ne,$e = 1 AND\n")
+
+	tests := []struct {
+		name    string
+		args    []string
+		code    int
+		out     []string
+		missing []string
+	}{
+		{"csv with header", []string{"--format", "csv", "--column", "condition", csv}, 1,
+			[]string{csv + " (row 3):\ncondition ends with a dangling 'AND'"}, []string{"(row 2)"}},
+		{"tsv without header", []string{"--format", "tsv", "--column", "2", "--header=false", tsv}, 1,
+			[]string{tsv + " (row 2):\n'=' needs a value on its right"}, []string{"(row 1)"}},
+		{"every row is validated", []string{"--format", "csv", "--column", "condition", ragged}, 1,
+			[]string{
+				ragged + " (row 3):\nrow 3 has no column 2",
+				ragged + " (row 4):\n'=' needs a value on its right",
+				ragged + " (row 5):\nparse error on line 5",
+				ragged + " (row 6):\ncondition ends with a dangling 'AND'",
+			}, []string{"(row 2)"}},
+		{"unknown column", []string{"--format", "csv", "--column", "nope", csv}, 1,
+			[]string{`no column named "nope" in header`}, nil},
+		{"column number needs no header", []string{"--format", "csv", "--column", "condition", "--header=false", csv}, 1,
+			[]string{"--column must be a 1-based column number"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, stdout, stderr := run(tt.args...)
+			if code != tt.code {
+				t.Errorf("exit code %d, want %d; stderr: %s", code, tt.code, stderr)
+			}
+			for _, want := range tt.out {
+				if !strings.Contains(stdout, want) {
+					t.Errorf("output %q does not contain %q", stdout, want)
+				}
+			}
+			for _, unwanted := range tt.missing {
+				if strings.Contains(stdout, unwanted) {
+					t.Errorf("output %q contains %q", stdout, unwanted)
+				}
+			}
+		})
+	}
+
+	if code, _, stderr := run("--format", "csv", csv); code != 1 || !strings.Contains(stderr, "--column is required") {
+		t.Errorf("csv without --column: exit code %d, stderr %q", code, stderr)
+	}
+}
+
+func TestDecodeBase64(t *testing.T) {
+	encode := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+	valid := writeFile(t, "valid.txt", encode(`$status = "a,b"`)+"\n")
+	invalid := writeFile(t, "invalid.txt", encode(`$status =`))
+	garbage := writeFile(t, "garbage.txt", "not base64!")
+	csv := writeFile(t, "defs.csv", "condition\n"+encode(`$a = 1`)+"\n")
+
+	tests := []struct {
+		name string
+		args []string
+		code int
+		out  string
+	}{
+		{"valid", []string{"--decode", "base64", valid}, 0, "Definition in file " + valid + " is valid!"},
+		{"invalid", []string{"--decode", "base64", invalid}, 1, "'=' needs a value on its right"},
+		{"not base64", []string{"--decode", "base64", garbage}, 1, "condition is not valid base64"},
+		{"csv column", []string{"--decode", "base64", "--format", "csv", "--column", "condition", csv}, 0, "Definition in file " + csv + " is valid!"},
+		{"without --decode", []string{valid}, 1, "Invalid derived column definition"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, stdout, stderr := run(tt.args...)
+			if code != tt.code {
+				t.Errorf("exit code %d, want %d; stderr: %s", code, tt.code, stderr)
+			}
+			if !strings.Contains(stdout, tt.out) {
+				t.Errorf("output %q does not contain %q", stdout, tt.out)
+			}
+		})
+	}
+}
+
+func TestJSONArray(t *testing.T) {
+	arr := writeFile(t, "filters.json", "[\n  \"$a = 1\",\n  \"$b = \\\"x\\\" AND\",\n  5,\n  \"$c >\"\n]\n")
+
+	code, stdout, _ := run("--format", "json", arr)
+	if code != 1 {
+		t.Errorf("exit code %d, want 1", code)
+	}
+	for _, want := range []string{
+		arr + " (index 1):\ncondition ends with a dangling 'AND'",
+		arr + " (index 2):\nexpected a condition string, got number",
+		arr + " (index 3):\n'>' needs a value on its right",
+	} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("output %q does not contain %q", stdout, want)
+		}
+	}
+	if strings.Contains(stdout, "(index 0)") {
+		t.Errorf("valid element reported:\n%s", stdout)
+	}
+
+	// The escaped quotes in index 1 leave its errors at the element.
+	code, stdout, _ = run("--format", "json", "--oneline", arr)
+	want := arr + ":3:4: error: condition ends with a dangling 'AND'; a generated clause is probably empty [HL021]\n" +
+		arr + ":4:3: error: expected a condition string, got number\n" +
+		arr + ":5:7: error: '>' needs a value on its right [HL038]\n"
+	if code != 1 || stdout != want {
+		t.Errorf("--oneline: exit code %d, output %q, want %q", code, stdout, want)
+	}
+
+	object := writeFile(t, "object.json", `{"condition": "$a = 1"}`)
+	if code, stdout, _ := run("--format", "json", object); code != 1 || !strings.Contains(stdout, "expected a JSON array of conditions") {
+		t.Errorf("object: exit code %d, output %q", code, stdout)
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	md := writeFile(t, "README.md", strings.Join([]string{
+		"# Columns",
+		"",
+		"```honeycomb",
+		"$status = 200",
+		"```",
+		"",
+		"```go",
+		"not a condition",
+		"```",
+		"",
+		"~~~honeycomb",
+		"$a = 1 AND",
+		"~~~",
+	}, "\n"))
+
+	code, stdout, _ := run("--format", "markdown", md)
+	if code != 1 {
+		t.Errorf("exit code %d, want 1", code)
+	}
+	if !strings.Contains(stdout, md+" (line 11):\ncondition ends with a dangling 'AND'") {
+		t.Errorf("invalid block not reported:\n%s", stdout)
+	}
+	if strings.Contains(stdout, "(line 3)") || strings.Contains(stdout, "(line 7)") {
+		t.Errorf("valid or untagged block reported:\n%s", stdout)
+	}
+
+	code, stdout, _ = run("--format", "markdown", "--oneline", md)
+	if want := md + ":12:8: error: condition ends with a dangling 'AND'; a generated clause is probably empty [HL021]\n"; code != 1 || stdout != want {
+		t.Errorf("--oneline: exit code %d, output %q, want %q", code, stdout, want)
+	}
+
+	unterminated := writeFile(t, "open.md", "```honeycomb\n$a = 1\n")
+	if code, stdout, _ := run("--format", "markdown", unterminated); code != 1 || !strings.Contains(stdout, "unterminated code block starting on line 1") {
+		t.Errorf("unterminated block: exit code %d, output %q", code, stdout)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// junitReport collects a run's results as JUnit test cases: one per
+// condition, failing when the condition is invalid.
+type junitReport struct {
+	cases    []junitCase
+	failures int
+	duration time.Duration
+}
+
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// add records the conditions of one file, leaving out the warnings that
+// out filters, as the text output does. Errors are always recorded as
+// failures, since they fail the run whatever is shown.
+func (r *junitReport) add(file string, res fileResult, out outputConfig) {
+	for _, e := range res.entries {
+		c := junitCase{Name: file, Classname: file}
+		if e.location != "" {
+			c.Name = file + " (" + e.location + ")"
+		}
+		if e.err != nil {
+			c.Failure = &junitFailure{Message: e.err.Error(), Type: errorCode(e.err), Text: e.err.Error()}
+			r.failures++
+		}
+		if !out.onlyErrors {
+			var warnings []string
+			for _, w := range e.warnings {
+				warnings = append(warnings, "warning: "+describeWarning(w, out.positionEncoding))
+			}
+			c.SystemOut = strings.Join(warnings, "\n")
+		}
+		r.cases = append(r.cases, c)
+	}
+}
+
+// write writes the report to path, or to stdout if path is "-".
+func (r *junitReport) write(path string, stdout io.Writer) error {
+	doc := junitSuites{Suites: []junitSuite{{
+		Name:     "honeylint",
+		Tests:    len(r.cases),
+		Failures: r.failures,
+		Time:     fmt.Sprintf("%.3f", r.duration.Seconds()),
+		Cases:    r.cases,
+	}}}
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append([]byte(xml.Header), append(data, '\n')...)
+
+	if path == "-" {
+		_, err = stdout.Write(data)
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestJUnit(t *testing.T) {
+	valid := writeFile(t, "valid.txt", `$status = 200`)
+	warned := writeFile(t, "warned.txt", `NOT NOT $a = 1`)
+	invalid := writeFile(t, "invalid.txt", `$status =`)
+
+	tests := []struct {
+		name     string
+		flags    []string
+		failures int
+		warnings bool
+	}{
+		{"all", nil, 1, true},
+		{"only errors", []string{"--only-errors"}, 1, false},
+		{"only warnings", []string{"--only-warnings"}, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append(append([]string{"--junit-out", "-"}, tt.flags...), valid, warned, invalid)
+			code, stdout, stderr := run(args...)
+			if code != 1 {
+				t.Errorf("exit code %d, want 1; stderr: %s", code, stderr)
+			}
+			if !strings.HasPrefix(stdout, xml.Header) {
+				t.Errorf("report does not start with the XML header: %q", stdout)
+			}
+			var doc junitSuites
+			if err := xml.Unmarshal([]byte(stdout), &doc); err != nil {
+				t.Fatalf("report is not well-formed XML: %v\n%s", err, stdout)
+			}
+			if len(doc.Suites) != 1 {
+				t.Fatalf("got %d suites, want 1", len(doc.Suites))
+			}
+			s := doc.Suites[0]
+			if s.Tests != 3 || len(s.Cases) != 3 || s.Failures != tt.failures {
+				t.Errorf("got %d tests, %d cases, %d failures; want 3, 3, %d", s.Tests, len(s.Cases), s.Failures, tt.failures)
+			}
+			for _, c := range s.Cases {
+				switch c.Name {
+				case invalid:
+					if (c.Failure != nil) != (tt.failures > 0) {
+						t.Errorf("%s: got failure %+v", c.Name, c.Failure)
+					}
+					if c.Failure != nil && c.Failure.Type != codeMissingOperand {
+						t.Errorf("%s: failure type %q, want %s", c.Name, c.Failure.Type, codeMissingOperand)
+					}
+				case warned:
+					if got := strings.Contains(c.SystemOut, "double-negation"); got != tt.warnings {
+						t.Errorf("%s: system-out %q", c.Name, c.SystemOut)
+					}
+				case valid:
+					if c.Failure != nil || c.SystemOut != "" {
+						t.Errorf("%s: got %+v", c.Name, c)
+					}
+				}
+			}
+		})
+	}
+}
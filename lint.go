@@ -0,0 +1,778 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Warning is a finding about a valid condition that is likely a mistake or
+// a maintenance problem. Warnings never make a condition invalid.
+type Warning struct {
+	Pos      int // byte offset
+	Line     int // 1-based line
+	Column   int // 1-based column, in characters
+	UTF16Pos int // offset in UTF-16 code units
+	Rule     string
+	Code     string // stable identifier of the rule; see codes.go
+	Message  string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%s (at offset %d) [%s]", w.Message, w.Pos, w.Rule)
+}
+
+// Result is the outcome of linting a condition.
+type Result struct {
+	// Warnings holds the warning diagnostics again as Warning values, for
+	// callers that predate Diagnostics. It is derived from Diagnostics.
+	Warnings []Warning
+	Stats    Stats // only filled in with WithInstrumentation(true)
+
+	// Diagnostics holds the error, if any, and the warnings as one list in
+	// source order, for reporters that render them together.
+	Diagnostics []Diagnostic
+
+	// Description is the text of the condition's trailing # comment.
+	Description string
+}
+
+// Severity is how serious a Diagnostic is.
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// Diagnostic is an error or warning about a condition. Rule is empty for
+// errors.
+type Diagnostic struct {
+	Pos      int // byte offset
+	Line     int // 1-based line
+	Column   int // 1-based column, in characters
+	UTF16Pos int // offset in UTF-16 code units
+	Severity Severity
+	Rule     string
+	Code     string
+	Message  string
+}
+
+// HasErrors reports whether any diagnostic is an error, i.e. whether the
+// condition is invalid.
+func (r *Result) HasErrors() bool {
+	for _, d := range r.Diagnostics {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter returns the diagnostics with the given severity, in order.
+func (r *Result) Filter(sev Severity) []Diagnostic {
+	var ds []Diagnostic
+	for _, d := range r.Diagnostics {
+		if d.Severity == sev {
+			ds = append(ds, d)
+		}
+	}
+	return ds
+}
+
+// errorDiagnostic converts a validation error to a Diagnostic. Errors
+// without a position are reported at the start of the input.
+func errorDiagnostic(err error) Diagnostic {
+	d := Diagnostic{Severity: SeverityError, Message: err.Error(), Line: 1, Column: 1}
+	var ve *ValidationError
+	if errors.As(err, &ve) {
+		d.Pos, d.Line, d.Column, d.UTF16Pos, d.Code, d.Message = ve.Pos, ve.Line, ve.Column, ve.UTF16Pos, ve.Code, ve.Message
+	}
+	return d
+}
+
+// Stats measures a single Lint call.
+type Stats struct {
+	LexTime   time.Duration
+	ParseTime time.Duration
+	Tokens    int
+}
+
+// WithInstrumentation makes Lint record timings and counts in Result.Stats.
+func WithInstrumentation(enabled bool) Option {
+	return func(c *config) {
+		c.instrument = enabled
+	}
+}
+
+// WithAnchorCheck enables the unanchored-regex rule, which is off by
+// default because unanchored patterns are often intended.
+func WithAnchorCheck(enabled bool) Option {
+	return func(c *config) {
+		c.anchorCheck = enabled
+	}
+}
+
+// WithMaxInItems sets how many values an IN list may have before the
+// in-list-length rule warns. Zero disables the rule.
+func WithMaxInItems(n int) Option {
+	return func(c *config) {
+		c.maxInItems = n
+	}
+}
+
+// defaultMaxLength is the default limit for the max-length rule.
+const defaultMaxLength = 4096
+
+// WithMaxLength sets how many characters a condition may have, once
+// whitespace is normalized, before the max-length rule warns. Zero disables
+// the rule.
+func WithMaxLength(n int) Option {
+	return func(c *config) {
+		c.maxLength = n
+	}
+}
+
+// WithDisabledRules turns off the named warning rules. A rule can be named
+// by its code, e.g. HL105, as well as by its name. Lint fails if a rule is
+// unknown, so a typo does not leave the rule on.
+func WithDisabledRules(rules ...string) Option {
+	return func(c *config) {
+		if c.disabled == nil {
+			c.disabled = make(map[string]bool)
+		}
+		for _, rule := range rules {
+			if err := checkRule(rule); err != nil && c.err == nil {
+				c.err = err
+			}
+			c.disabled[rule] = true
+		}
+	}
+}
+
+// errUnknownRule is wrapped by the error for a rule name or code that no
+// warning rule has.
+var errUnknownRule = errors.New("unknown warning rule")
+
+// checkRule reports an error unless rule is the name or code of a warning
+// rule.
+func checkRule(rule string) error {
+	if _, ok := ruleCodes[rule]; ok {
+		return nil
+	}
+	for _, code := range ruleCodes {
+		if code == rule {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w %q", errUnknownRule, rule)
+}
+
+// lintRules run over the tokens of a condition that has already been
+// validated by parse.
+var lintRules = []func(tokens []item, cfg *config) []Warning{
+	lintInListLength,
+	lintInListTypes,
+	lintDoubleNegation,
+	lintNegatedField,
+	lintExistenceStyle,
+	lintConstantComparison,
+	lintNoField,
+	lintFieldTypes,
+	lintUnanchoredRegex,
+	lintRegexOperand,
+	lintNumericString,
+	lintQuotedFieldSpacing,
+}
+
+// Lint validates input like ParseCondition and, if it is valid, returns the
+// warnings found by the enabled lint rules. If input is invalid, Lint
+// returns the error along with a Result whose only diagnostic is that error.
+func Lint(input string, opts ...Option) (*Result, error) {
+	l := NewLexer(input, opts...)
+	res := &Result{}
+	if l.cfg.err != nil {
+		return res, l.cfg.err
+	}
+
+	start := time.Now()
+	tokens, err := tokenize(l)
+	lexed := time.Now()
+	res.Description = l.comment
+	if err == nil {
+		err = validate(l.code(), tokens, &l.cfg)
+	}
+	if l.cfg.instrument {
+		res.Stats = Stats{
+			LexTime:   lexed.Sub(start),
+			ParseTime: time.Since(lexed),
+			Tokens:    len(tokens),
+		}
+	}
+	if err != nil {
+		err = locateError(input, err)
+		res.Diagnostics = []Diagnostic{errorDiagnostic(err)}
+		return res, err
+	}
+
+	// The length check needs the source text, which the token rules do
+	// not see. A trailing comment does not count against the limit.
+	warnings := lintLength(l.code(), tokens, &l.cfg)
+	for _, rule := range lintRules {
+		warnings = append(warnings, rule(tokens, &l.cfg)...)
+	}
+	for _, w := range warnings {
+		w.Code = ruleCodes[w.Rule]
+		if !l.cfg.disabled[w.Rule] && !l.cfg.disabled[w.Code] {
+			d := Diagnostic{Pos: w.Pos, Severity: SeverityWarning, Rule: w.Rule, Code: w.Code, Message: w.Message}
+			d.Line, d.Column, d.UTF16Pos = locate(input, w.Pos)
+			res.Diagnostics = append(res.Diagnostics, d)
+		}
+	}
+	// Report in source order, not rule order, so output is stable as rules
+	// are added and diff cleanly between runs.
+	sort.SliceStable(res.Diagnostics, func(i, j int) bool {
+		a, b := res.Diagnostics[i], res.Diagnostics[j]
+		if a.Pos != b.Pos {
+			return a.Pos < b.Pos
+		}
+		return a.Rule < b.Rule
+	})
+	for _, d := range res.Diagnostics {
+		res.Warnings = append(res.Warnings, Warning{
+			Pos:      d.Pos,
+			Line:     d.Line,
+			Column:   d.Column,
+			UTF16Pos: d.UTF16Pos,
+			Rule:     d.Rule,
+			Code:     d.Code,
+			Message:  d.Message,
+		})
+	}
+	return res, nil
+}
+
+// lintLength flags conditions longer than the configured limit. Length is
+// counted in characters after trimming and collapsing each run of
+// whitespace between tokens to a single space, so indentation and line
+// breaks do not count against it.
+func lintLength(input string, tokens []item, cfg *config) []Warning {
+	if cfg.maxLength <= 0 || len(tokens) == 0 {
+		return nil
+	}
+	n := 0
+	for i, t := range tokens {
+		next := len(input)
+		if i+1 < len(tokens) {
+			next = tokens[i+1].pos
+		}
+		lexeme := strings.TrimRightFunc(input[t.pos:next], unicode.IsSpace)
+		n += utf8.RuneCountInString(lexeme)
+		if i+1 < len(tokens) && t.pos+len(lexeme) < next {
+			n++
+		}
+	}
+	if n <= cfg.maxLength {
+		return nil
+	}
+	return []Warning{{
+		Pos:     tokens[0].pos,
+		Rule:    "max-length",
+		Message: fmt.Sprintf("condition is %d characters long, over the limit of %d", n, cfg.maxLength),
+	}}
+}
+
+// lintInListLength flags IN lists long enough to suggest generated bloat.
+func lintInListLength(tokens []item, cfg *config) []Warning {
+	if cfg.maxInItems <= 0 {
+		return nil
+	}
+	var warnings []Warning
+	for i := range tokens {
+		if tokens[i].tok != IN {
+			continue
+		}
+		values, _ := readList(tokens, i+1)
+		n := len(values)
+		if !isInfixIn(tokens, i) {
+			n-- // the function form's first argument is the field
+		}
+		if n > cfg.maxInItems {
+			warnings = append(warnings, Warning{
+				Pos:     tokens[i].pos,
+				Rule:    "in-list-length",
+				Message: fmt.Sprintf("IN list has %d values, more than the limit of %d", n, cfg.maxInItems),
+			})
+		}
+	}
+	return warnings
+}
+
+// lintInListTypes flags IN list values whose type does not match the left
+// operand. The type of a literal operand is known, so every value of another
+// type is flagged. A field's type is unknown, but it has only one, so a list
+// that mixes types, as in $status IN (200, "ok"), is flagged once. Nulls
+// match any type.
+func lintInListTypes(tokens []item, cfg *config) []Warning {
+	var warnings []Warning
+	for i := range tokens {
+		if tokens[i].tok != IN || i+1 >= len(tokens) || tokens[i+1].tok != LPAREN {
+			continue
+		}
+		values, err := readList(tokens, i+1)
+		if err != nil || len(values) == 0 {
+			continue
+		}
+		var left item
+		if isInfixIn(tokens, i) {
+			left = tokens[i-1]
+		} else {
+			left, values = values[0], values[1:]
+		}
+
+		known := isLiteral(left.tok) && left.tok != NULL
+		want := left.tok
+		for _, v := range values {
+			if !isLiteral(v.tok) || v.tok == NULL {
+				continue
+			}
+			if !known {
+				known, want = true, v.tok
+				continue
+			}
+			if v.tok == want {
+				continue
+			}
+			msg := fmt.Sprintf("IN list mixes %s and %s values, but a field has a single type", literalKind(want), literalKind(v.tok))
+			if isLiteral(left.tok) {
+				msg = fmt.Sprintf("IN list value %s is %s, but the left operand is %s", v.lit, aLiteralKind(v.tok), aLiteralKind(want))
+			}
+			warnings = append(warnings, Warning{Pos: v.pos, Rule: "in-list-types", Message: msg})
+			if !isLiteral(left.tok) {
+				break
+			}
+		}
+	}
+	return warnings
+}
+
+// lintDoubleNegation flags runs of consecutive NOTs, which cancel out in
+// pairs.
+func lintDoubleNegation(tokens []item, cfg *config) []Warning {
+	var warnings []Warning
+	for i := 0; i < len(tokens); i++ {
+		if tokens[i].tok != NOT {
+			continue
+		}
+		j := i
+		for j < len(tokens) && tokens[j].tok == NOT {
+			j++
+		}
+		if n := j - i; n > 1 {
+			msg := fmt.Sprintf("%d consecutive NOTs cancel out; remove them", n)
+			if n%2 == 1 {
+				msg = fmt.Sprintf("%d consecutive NOTs are the same as a single NOT", n)
+			}
+			warnings = append(warnings, Warning{Pos: tokens[i].pos, Rule: "double-negation", Message: msg})
+		}
+		i = j
+	}
+	return warnings
+}
+
+// lintNegatedField flags NOT applied to a bare field, as in NOT $a or
+// NOT ($a). Field values have no implicit truthiness, so it is unclear
+// whether a comparison or NOT EXISTS($a) was meant.
+func lintNegatedField(tokens []item, cfg *config) []Warning {
+	var warnings []Warning
+	for i := 0; i+1 < len(tokens); i++ {
+		if tokens[i].tok != NOT {
+			continue
+		}
+		j := i + 1
+		parens := 0
+		for j < len(tokens) && tokens[j].tok == LPAREN {
+			j++
+			parens++
+		}
+		if j >= len(tokens) || tokens[j].tok != IDENT {
+			continue
+		}
+		end := j + 1
+		for k := 0; k < parens && end < len(tokens) && tokens[end].tok == RPAREN; k++ {
+			end++
+		}
+		if end-j-1 != parens {
+			continue
+		}
+		if end < len(tokens) && tokens[end].tok != AND && tokens[end].tok != OR && tokens[end].tok != RPAREN {
+			continue
+		}
+		field := tokens[j].lit
+		warnings = append(warnings, Warning{
+			Pos:     tokens[i].pos,
+			Rule:    "negated-field",
+			Message: fmt.Sprintf("NOT is applied to field %q, which is not a condition; compare it explicitly or use NOT EXISTS", field),
+		})
+	}
+	return warnings
+}
+
+// lintExistenceStyle flags fields whose presence is tested both with EXISTS
+// and with a null comparison. The two read alike but "$a != null" and
+// EXISTS($a) are not guaranteed to agree, so one idiom should be picked.
+func lintExistenceStyle(tokens []item, cfg *config) []Warning {
+	exists := make(map[string]bool)
+	null := make(map[string]bool)
+	var warnings []Warning
+	for i, t := range tokens {
+		var field string
+		var seen, other map[string]bool
+		switch {
+		case t.tok == EXISTS && followedByField(tokens, i):
+			field = tokens[i+1].lit
+			if tokens[i+1].tok == LPAREN {
+				field = tokens[i+2].lit
+			}
+			seen, other = exists, null
+		case t.tok == NULL:
+			field = nullComparedField(tokens, i)
+			seen, other = null, exists
+		}
+		if field == "" {
+			continue
+		}
+		if other[field] && !seen[field] {
+			warnings = append(warnings, Warning{
+				Pos:     t.pos,
+				Rule:    "existence-style",
+				Message: fmt.Sprintf("field %q is tested with both EXISTS and a null comparison; use one consistently", field),
+			})
+		}
+		seen[field] = true
+	}
+	return warnings
+}
+
+// nullComparedField returns the field compared for (in)equality with the
+// null at tokens[i], or "" if there is none.
+func nullComparedField(tokens []item, i int) string {
+	isEq := func(tok Token) bool { return tok == EQUALS || tok == NOT_EQUALS }
+	if i >= 2 && isEq(tokens[i-1].tok) && tokens[i-2].tok == IDENT {
+		return tokens[i-2].lit
+	}
+	if i+2 < len(tokens) && isEq(tokens[i+1].tok) && tokens[i+2].tok == IDENT {
+		return tokens[i+2].lit
+	}
+	return ""
+}
+
+// lintNoField flags conditions that reference no field at all: they ignore
+// the event data and match either everything or nothing.
+func lintNoField(tokens []item, cfg *config) []Warning {
+	for _, t := range tokens {
+		if t.tok == IDENT {
+			return nil
+		}
+	}
+	return []Warning{{Pos: tokens[0].pos, Rule: "no-field", Message: "condition does not reference any field"}}
+}
+
+// lintConstantComparison flags comparisons between two literals, which are
+// usually left over from testing, and reports what they fold to.
+func lintConstantComparison(tokens []item, cfg *config) []Warning {
+	var warnings []Warning
+	for i := 1; i+1 < len(tokens); i++ {
+		op := tokens[i].tok
+		if op != EQUALS && op != NOT_EQUALS && !isOrdering(op) {
+			continue
+		}
+		a, b := tokens[i-1], tokens[i+1]
+		if !isLiteral(a.tok) || !isLiteral(b.tok) {
+			continue
+		}
+		// The default of $a ?? 0 is not a constant operand.
+		if i >= 2 && tokens[i-2].tok == COALESCE || i+2 < len(tokens) && tokens[i+2].tok == COALESCE {
+			continue
+		}
+		msg := "comparison between two constants does not depend on any field"
+		if v, ok := foldComparison(a, op, b); ok {
+			msg = fmt.Sprintf("comparison between two constants is always %t", v)
+		}
+		warnings = append(warnings, Warning{Pos: a.pos, Rule: "constant-comparison", Message: msg})
+	}
+	return warnings
+}
+
+// foldComparison evaluates a comparison between two literals. ok is false
+// when the result cannot be determined, e.g. ordering a string and a number.
+func foldComparison(a item, op Token, b item) (result bool, ok bool) {
+	var cmp int
+	switch {
+	case a.tok == NUMBER && b.tok == NUMBER:
+		x, errA := strconv.ParseFloat(a.lit, 64)
+		y, errB := strconv.ParseFloat(b.lit, 64)
+		if errA != nil || errB != nil {
+			return false, false
+		}
+		switch {
+		case x < y:
+			cmp = -1
+		case x > y:
+			cmp = 1
+		}
+	case a.tok == STRING && b.tok == STRING:
+		x, errA := strconv.Unquote(a.lit)
+		y, errB := strconv.Unquote(b.lit)
+		if errA != nil || errB != nil {
+			return false, false
+		}
+		switch {
+		case x < y:
+			cmp = -1
+		case x > y:
+			cmp = 1
+		}
+	case a.tok == b.tok: // booleans or nulls
+		if a.lit != b.lit {
+			cmp = 1
+		}
+	default:
+		// Literals of different kinds are never equal, but have no order.
+		if isOrdering(op) {
+			return false, false
+		}
+		cmp = 1
+	}
+
+	switch op {
+	case EQUALS:
+		return cmp == 0, true
+	case NOT_EQUALS:
+		return cmp != 0, true
+	case LT:
+		return cmp < 0, true
+	case LTE:
+		return cmp <= 0, true
+	case GT:
+		return cmp > 0, true
+	case GTE:
+		return cmp >= 0, true
+	}
+	return false, false
+}
+
+// lintFieldTypes flags a field that is compared with literals of different
+// types within one AND chain, e.g. $x > 5 AND $x = "abc": without a schema
+// this is the best hint that one of the comparisons is wrong. Chains end at
+// an OR. A group without an OR of its own is part of the chain around it,
+// as in $x > 5 AND ($x = "abc"); a group with one starts a chain per
+// alternative.
+func lintFieldTypes(tokens []item, cfg *config) []Warning {
+	var warnings []Warning
+	chains := []map[string]Token{{}}
+	var opened []bool // per open paren, whether it pushed a chain
+	for i, t := range tokens {
+		switch t.tok {
+		case LPAREN:
+			push := groupHasOr(tokens, i)
+			if push {
+				chains = append(chains, map[string]Token{})
+			}
+			opened = append(opened, push)
+			continue
+		case RPAREN:
+			if n := len(opened); n > 0 {
+				if opened[n-1] && len(chains) > 1 {
+					chains = chains[:len(chains)-1]
+				}
+				opened = opened[:n-1]
+			}
+			continue
+		case OR:
+			chains[len(chains)-1] = map[string]Token{}
+			continue
+		}
+		if t.tok != EQUALS && t.tok != NOT_EQUALS && !isOrdering(t.tok) || i == 0 || i+1 >= len(tokens) {
+			continue
+		}
+		field, lit := tokens[i-1], tokens[i+1]
+		if field.tok != IDENT {
+			field, lit = lit, field
+		}
+		if field.tok != IDENT || !isLiteral(lit.tok) || lit.tok == NULL {
+			continue
+		}
+		chain := chains[len(chains)-1]
+		if prev, ok := chain[field.lit]; ok && prev != lit.tok {
+			warnings = append(warnings, Warning{
+				Pos:     lit.pos,
+				Rule:    "field-type-conflict",
+				Message: fmt.Sprintf("field %q is compared with a %s here but with a %s earlier in the same AND chain", field.lit, literalKind(lit.tok), literalKind(prev)),
+			})
+			continue
+		}
+		chain[field.lit] = lit.tok
+	}
+	return warnings
+}
+
+// groupHasOr reports whether the group opened at tokens[open] has an OR
+// outside any nested group.
+func groupHasOr(tokens []item, open int) bool {
+	depth := 0
+	for _, t := range tokens[open:] {
+		switch t.tok {
+		case LPAREN:
+			depth++
+		case RPAREN:
+			if depth--; depth == 0 {
+				return false
+			}
+		case OR:
+			if depth == 1 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func literalKind(tok Token) string {
+	switch tok {
+	case NUMBER:
+		return "number"
+	case STRING:
+		return "string"
+	case BOOLEAN:
+		return "boolean"
+	}
+	return "null"
+}
+
+// aLiteralKind is literalKind with an article, for use in a sentence: "a
+// number", but "null".
+func aLiteralKind(tok Token) string {
+	if tok == NULL {
+		return "null"
+	}
+	return "a " + literalKind(tok)
+}
+
+// lintUnanchoredRegex flags =~ patterns that look like a path prefix but
+// lack a ^ anchor. =~ matches anywhere in the value, so $path =~ "/api" also
+// matches "/v2/api/health".
+func lintUnanchoredRegex(tokens []item, cfg *config) []Warning {
+	if !cfg.anchorCheck {
+		return nil
+	}
+	var warnings []Warning
+	for i := 0; i+1 < len(tokens); i++ {
+		if tokens[i].tok != REG_MATCH || tokens[i+1].tok != STRING {
+			continue
+		}
+		pattern, err := strconv.Unquote(tokens[i+1].lit)
+		if err == nil && unanchoredPath(pattern) {
+			warnings = append(warnings, Warning{
+				Pos:     tokens[i+1].pos,
+				Rule:    "unanchored-regex",
+				Message: fmt.Sprintf("regex %s is unanchored and matches anywhere in the value; anchor it with ^ or use STARTS_WITH", tokens[i+1].lit),
+			})
+		}
+	}
+	return warnings
+}
+
+// unanchoredPath reports whether pattern looks like a path prefix but has
+// no ^ anchor.
+func unanchoredPath(pattern string) bool {
+	if strings.HasPrefix(pattern, "^") {
+		return false
+	}
+	return strings.HasPrefix(pattern, "/") ||
+		strings.Contains(pattern, "/") && !strings.ContainsAny(pattern, `$.*+?()[]{}|\`)
+}
+
+// lintRegexOperand flags =~ whose left operand is a number, boolean or
+// null literal. The pattern is matched against a string, so such a match is
+// almost certainly a mistake. Fields are not flagged; their type is unknown.
+func lintRegexOperand(tokens []item, cfg *config) []Warning {
+	var warnings []Warning
+	for i := 1; i < len(tokens); i++ {
+		left := tokens[i-1]
+		if tokens[i].tok != REG_MATCH || !isLiteral(left.tok) || left.tok == STRING {
+			continue
+		}
+		warnings = append(warnings, Warning{
+			Pos:     left.pos,
+			Rule:    "regex-operand-type",
+			Message: "=~ matches strings, but its left operand is " + aLiteralKind(left.tok),
+		})
+	}
+	return warnings
+}
+
+// lintNumericString flags the numeric strings that WithNumericStringCoercion
+// accepts in ordering comparisons, so they can be fixed at the source.
+func lintNumericString(tokens []item, cfg *config) []Warning {
+	if !cfg.coerceNumericStrings {
+		return nil
+	}
+	var warnings []Warning
+	for i := range tokens {
+		if !isOrdering(tokens[i].tok) {
+			continue
+		}
+		if s, ok := numericString(tokens, i); ok {
+			warnings = append(warnings, Warning{
+				Pos:     s.pos,
+				Rule:    "numeric-string",
+				Message: fmt.Sprintf("string %s is compared as the number %s; remove the quotes", s.lit, s.lit[1:len(s.lit)-1]),
+			})
+		}
+	}
+	return warnings
+}
+
+// lintQuotedFieldSpacing flags a backtick-quoted field name that differs from
+// another field in the condition only by surrounding whitespace, such as
+// `status ` next to $status. Quoting keeps the spaces, so these are
+// different columns, which is rarely what was meant.
+func lintQuotedFieldSpacing(tokens []item, cfg *config) []Warning {
+	names := make(map[string]bool)
+	for _, t := range tokens {
+		if t.tok == IDENT {
+			names[t.lit] = true
+		}
+	}
+	var warnings []Warning
+	for _, t := range tokens {
+		if t.tok != IDENT || !t.quoted {
+			continue
+		}
+		trimmed := strings.TrimSpace(t.lit)
+		if trimmed != t.lit && names[trimmed] {
+			warnings = append(warnings, Warning{
+				Pos:     t.pos,
+				Rule:    "quoted-field-spacing",
+				Message: fmt.Sprintf("quoted field name %q differs from field %q only by surrounding whitespace", t.lit, trimmed),
+			})
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// ruleWarnings returns the warnings the named rule reports for condition.
+func ruleWarnings(t *testing.T, condition, rule string, opts ...Option) []Warning {
+	t.Helper()
+	res, err := Lint(condition, opts...)
+	if err != nil {
+		t.Fatalf("Lint(%q): %v", condition, err)
+	}
+	var ws []Warning
+	for _, w := range res.Warnings {
+		if w.Rule == rule {
+			ws = append(ws, w)
+		}
+	}
+	return ws
+}
+
+// lintTest is a condition and the number of warnings a rule should report
+// for it.
+type lintTest struct {
+	condition string
+	warnings  int
+}
+
+// testRule lints each of tests with opts and checks how often rule fires.
+func testRule(t *testing.T, rule string, tests []lintTest, opts ...Option) {
+	t.Helper()
+	for _, tt := range tests {
+		if ws := ruleWarnings(t, tt.condition, rule, opts...); len(ws) != tt.warnings {
+			t.Errorf("Lint(%q): got %d %s warnings, want %d: %v", tt.condition, len(ws), rule, tt.warnings, ws)
+		}
+	}
+}
+
+// inList returns a condition testing $x against an IN list of n numbers.
+func inList(n int) string {
+	values := make([]string, n)
+	for i := range values {
+		values[i] = strconv.Itoa(i)
+	}
+	return "$x IN (" + strings.Join(values, ", ") + ")"
+}
+
+func TestInListLength(t *testing.T) {
+	testRule(t, "in-list-length", []lintTest{
+		{inList(50), 0},
+		{inList(51), 1},
+		{"IN($x, " + inList(51)[7:], 1},
+	})
+	testRule(t, "in-list-length", []lintTest{
+		{inList(3), 0},
+		{inList(4), 1},
+	}, WithMaxInItems(3))
+	testRule(t, "in-list-length", []lintTest{{inList(100), 0}}, WithMaxInItems(0))
+	testRule(t, "in-list-length", []lintTest{{inList(51), 0}}, WithDisabledRules("in-list-length"))
+	testRule(t, "in-list-length", []lintTest{{inList(51), 0}}, WithDisabledRules("HL101"))
+	if _, err := Lint(inList(51), WithDisabledRules("in-list-lenght")); !errors.Is(err, errUnknownRule) {
+		t.Errorf("unknown rule: got error %v", err)
+	}
+
+	ws := ruleWarnings(t, inList(51), "in-list-length")
+	if len(ws) == 1 && ws[0].Message != "IN list has 51 values, more than the limit of 50" {
+		t.Errorf("got message %q", ws[0].Message)
+	}
+}
+
+func TestInstrumentation(t *testing.T) {
+	condition := `$status = 200 AND $duration_ms > 100`
+	res, err := Lint(condition, WithInstrumentation(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Stats.Tokens != 7 {
+		t.Errorf("got %d tokens, want 7", res.Stats.Tokens)
+	}
+	if res.Stats.LexTime < 0 || res.Stats.ParseTime < 0 || res.Stats.LexTime+res.Stats.ParseTime == 0 {
+		t.Errorf("timings not recorded: %+v", res.Stats)
+	}
+
+	res, err = Lint(condition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Stats != (Stats{}) {
+		t.Errorf("got stats %+v without instrumentation, want zero", res.Stats)
+	}
+}
+
+func TestDoubleNegation(t *testing.T) {
+	testRule(t, "double-negation", []lintTest{
+		{`NOT $a = 1`, 0},
+		{`NOT NOT $a = 1`, 1},
+		{`NOT NOT NOT $a = 1`, 1},
+		{`NOT NOT $a = 1 AND NOT NOT $b = 2`, 2},
+		{`NOT ($a = 1 AND NOT $b = 2)`, 0},
+	})
+	for _, tt := range []struct {
+		condition, message string
+	}{
+		{`NOT NOT $a = 1`, "2 consecutive NOTs cancel out; remove them"},
+		{`NOT NOT NOT $a = 1`, "3 consecutive NOTs are the same as a single NOT"},
+	} {
+		if ws := ruleWarnings(t, tt.condition, "double-negation"); len(ws) != 1 || ws[0].Message != tt.message {
+			t.Errorf("Lint(%q) = %v, want %q", tt.condition, ws, tt.message)
+		}
+	}
+}
+
+func TestExistenceStyle(t *testing.T) {
+	testRule(t, "existence-style", []lintTest{
+		{`EXISTS($a) AND EXISTS($b)`, 0},
+		{`$a != null AND null = $b`, 0},
+		{`EXISTS($a) AND $b != null`, 0},
+		{`EXISTS($a) AND $a != null`, 1},
+		{`$a = null OR NOT EXISTS $a`, 1},
+		{`EXISTS($a) AND $a != null AND $a = null`, 1},
+	})
+}
+
+func TestConstantComparison(t *testing.T) {
+	tests := []struct {
+		condition string
+		message   string
+	}{
+		{`5 > 3`, "comparison between two constants is always true"},
+		{`1 = 2`, "comparison between two constants is always false"},
+		{`"a" != "b"`, "comparison between two constants is always true"},
+		{`"a" < 2`, "comparison between two constants does not depend on any field"},
+		{`$a = 1`, ""},
+		{`$a ?? 0 = 1`, ""},
+	}
+	for _, tt := range tests {
+		ws := ruleWarnings(t, tt.condition, "constant-comparison")
+		switch {
+		case tt.message == "" && len(ws) != 0:
+			t.Errorf("Lint(%q): unexpected warnings %v", tt.condition, ws)
+		case tt.message != "" && (len(ws) != 1 || ws[0].Message != tt.message):
+			t.Errorf("Lint(%q) = %v, want %q", tt.condition, ws, tt.message)
+		}
+	}
+}
+
+func TestNoField(t *testing.T) {
+	testRule(t, "no-field", []lintTest{
+		{`true`, 1},
+		{`1 = 1`, 1},
+		{`$a = true`, 0},
+		{`EXISTS($a)`, 0},
+	})
+}
+
+func TestWarningOrder(t *testing.T) {
+	condition := `NOT NOT 1 = 1 AND "a" = "a" AND 2 > 1`
+	var first []Warning
+	for i := 0; i < 20; i++ {
+		res, err := Lint(condition)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			first = res.Warnings
+			continue
+		}
+		if len(res.Warnings) != len(first) {
+			t.Fatalf("run %d: got %d warnings, then %d", i, len(first), len(res.Warnings))
+		}
+		for j := range first {
+			if res.Warnings[j] != first[j] {
+				t.Fatalf("run %d: warning %d is %v, was %v", i, j, res.Warnings[j], first[j])
+			}
+		}
+	}
+
+	var got []string
+	for _, w := range first {
+		got = append(got, strconv.Itoa(w.Pos)+" "+w.Rule)
+	}
+	want := []string{"0 double-negation", "0 no-field", "8 constant-comparison", "18 constant-comparison", "32 constant-comparison"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("got order %q, want %q", got, want)
+	}
+}
+
+func TestFieldTypeConflict(t *testing.T) {
+	testRule(t, "field-type-conflict", []lintTest{
+		{`$x > 5 AND $x = "abc"`, 1},
+		{`$x > 5 AND "abc" = $x`, 1},
+		{`$x > 5 AND $x < 10`, 0},
+		{`$x = 5 OR $x = "abc"`, 0},
+		{`$x = 5 AND ($x = "abc" OR $y = 1)`, 0},
+		{`$x = 5 AND $x != null`, 0},
+		{`$x = 5 AND $y = "abc"`, 0},
+		{`$x > 5 AND ($x = "abc")`, 1},
+		{`($x > 5) AND ($x = "abc")`, 1},
+		{`($x > 5 AND $y = 1) AND $x = "abc"`, 1},
+		{`($x > 5 OR $y = 1) AND $x = "abc"`, 0},
+		{`$x > 5 OR ($x = "abc")`, 0},
+	})
+}
+
+func TestUnanchoredRegex(t *testing.T) {
+	tests := []lintTest{
+		{`$path =~ "/api"`, 1},
+		{`$path =~ "api/v2"`, 1},
+		{`$path =~ "^/api"`, 0},
+		{`$path =~ "api"`, 0},
+		{`$path =~ "/api/.*"`, 1},
+		{`$path =~ "v[0-9]+/users"`, 0},
+	}
+	testRule(t, "unanchored-regex", tests, WithAnchorCheck(true))
+	testRule(t, "unanchored-regex", []lintTest{{`$path =~ "/api"`, 0}})
+}
+
+func TestQuotedFieldSpacing(t *testing.T) {
+	testRule(t, "quoted-field-spacing", []lintTest{
+		{"`status ` = 1 AND $status = 2", 1},
+		{"` status` = 1 OR status = 2", 1},
+		{"`status` = 1 AND $status = 2", 0},
+		{"`service name` = \"a\"", 0},
+	})
+}
+
+func TestRegexOperandType(t *testing.T) {
+	testRule(t, "regex-operand-type", []lintTest{
+		{`5 =~ "5"`, 1},
+		{`true =~ "t"`, 1},
+		{`null =~ "x"`, 1},
+		{`"abc" =~ "b"`, 0},
+		{`$status =~ "^5"`, 0},
+	})
+	if ws := ruleWarnings(t, `5 =~ "5"`, "regex-operand-type"); len(ws) == 1 && ws[0].Message != "=~ matches strings, but its left operand is a number" {
+		t.Errorf("got message %q", ws[0].Message)
+	}
+}
+
+func TestMaxLength(t *testing.T) {
+	long := `$a = "` + strings.Repeat("x", 20) + `"` // 27 characters
+	testRule(t, "max-length", []lintTest{
+		{long, 0},
+		{long + " AND $b = 1", 1},
+		{"  $a   =\n\t\"" + strings.Repeat("x", 20) + "\"  ", 0},
+	}, WithMaxLength(27))
+	testRule(t, "max-length", []lintTest{{long, 1}}, WithMaxLength(26))
+	testRule(t, "max-length", []lintTest{{long, 0}}, WithMaxLength(0))
+	testRule(t, "max-length", []lintTest{{`$a = "` + strings.Repeat("x", defaultMaxLength) + `"`, 1}})
+
+	if ws := ruleWarnings(t, long, "max-length", WithMaxLength(20)); len(ws) != 1 || ws[0].Message != "condition is 27 characters long, over the limit of 20" {
+		t.Errorf("got %v", ws)
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	res, err := Lint(`NOT NOT 1 = 1 AND 2 > 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.HasErrors() {
+		t.Error("HasErrors on a valid condition")
+	}
+	if len(res.Diagnostics) != len(res.Warnings) {
+		t.Fatalf("got %d diagnostics for %d warnings", len(res.Diagnostics), len(res.Warnings))
+	}
+	for i, d := range res.Diagnostics {
+		if i > 0 && d.Pos < res.Diagnostics[i-1].Pos {
+			t.Errorf("diagnostic %d at offset %d comes after offset %d", i, d.Pos, res.Diagnostics[i-1].Pos)
+		}
+		if w := res.Warnings[i]; d.Severity != SeverityWarning || d.Rule != w.Rule || d.Code != w.Code || d.Pos != w.Pos {
+			t.Errorf("diagnostic %d is %+v for warning %+v", i, d, w)
+		}
+	}
+	if got := res.Filter(SeverityWarning); len(got) != len(res.Diagnostics) {
+		t.Errorf("Filter(warning) returned %d of %d", len(got), len(res.Diagnostics))
+	}
+	if got := res.Filter(SeverityError); len(got) != 0 {
+		t.Errorf("Filter(error) = %v, want none", got)
+	}
+
+	res, err = Lint("$a = 1 AND\n$b =")
+	if err == nil {
+		t.Fatal("want an error")
+	}
+	if !res.HasErrors() || len(res.Diagnostics) != 1 {
+		t.Fatalf("got diagnostics %+v, want the error alone", res.Diagnostics)
+	}
+	if d := res.Diagnostics[0]; d.Severity != SeverityError || d.Code != codeMissingOperand || d.Line != 2 || d.Column != 4 || d.Rule != "" {
+		t.Errorf("got %+v", d)
+	}
+	if got := res.Filter(SeverityError); len(got) != 1 {
+		t.Errorf("Filter(error) = %v, want the error", got)
+	}
+
+	for sev, want := range map[Severity]string{SeverityError: "error", SeverityWarning: "warning", Severity(2): "Severity(2)", Severity(7): "Severity(7)"} {
+		if sev.String() != want {
+			t.Errorf("Severity(%d).String() = %q, want %q", int(sev), sev.String(), want)
+		}
+	}
+}
+
+func TestNegatedField(t *testing.T) {
+	testRule(t, "negated-field", []lintTest{
+		{`NOT ($a = 1)`, 0},
+		{`NOT EXISTS($a)`, 0},
+		{`NOT $a`, 1},
+		{`NOT ($a)`, 1},
+		{`NOT $a AND $b = 1`, 1},
+		{`$b = 1 OR (NOT $a)`, 1},
+		{`NOT $a = 1`, 0},
+	})
+}
+
+func TestInListTypes(t *testing.T) {
+	testRule(t, "in-list-types", []lintTest{
+		{`$status IN (200, 404, 500)`, 0},
+		{`$status IN (200, "ok")`, 1},
+		{`$status IN (200, "ok", true)`, 1},
+		{`$status IN (200, null)`, 0},
+		{`IN($status, "a", 2)`, 1},
+		{`5 IN (1, "a", "b")`, 2},
+		{`$a IN $tags`, 0},
+	})
+	if ws := ruleWarnings(t, `5 IN (1, "a")`, "in-list-types"); len(ws) != 1 || ws[0].Message != `IN list value "a" is a string, but the left operand is a number` {
+		t.Errorf("got %v", ws)
+	}
+}
+
+func TestTrailingComment(t *testing.T) {
+	tests := []struct {
+		condition   string
+		description string
+		err         string
+	}{
+		{`$status = 200 # only successes`, "only successes", ""},
+		{"$status = 200 #   padded  \n\n  ", "padded", ""},
+		{`$status = 200 #`, "", ""},
+		{"$status = 200 # first\n$a = 1", "", "a # comment must come at the end of the condition"},
+		{`$flag # the flag`, "", `$flag is a bare field reference; compare it (e.g. $flag = "value") or use EXISTS($flag)`},
+	}
+	for _, tt := range tests {
+		res, err := Lint(tt.condition)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("Lint(%q): unexpected error: %v", tt.condition, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("Lint(%q) = %v, want an error containing %q", tt.condition, err, tt.err)
+		case err == nil && res.Description != tt.description:
+			t.Errorf("Lint(%q) has description %q, want %q", tt.condition, res.Description, tt.description)
+		}
+	}
+}
+
+func TestTrailingCommentSkipsMaxLength(t *testing.T) {
+	res, err := Lint(`$a = 1 # `+strings.Repeat("x", 40), WithMaxLength(20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Warnings) != 0 {
+		t.Errorf("a long comment was counted against the length limit: %+v", res.Warnings)
+	}
+}
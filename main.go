@@ -1,9 +1,23 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 type Definition struct {
@@ -11,27 +25,566 @@ type Definition struct {
 }
 
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Println("Usage: honeycomb-linter <filename>")
-		os.Exit(1)
+	os.Exit(Run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// Run runs the linter with the given command-line arguments (without the
+// program name) and returns the process exit code. It never exits itself,
+// so it can be called from tests and other programs.
+func Run(args []string, stdout, stderr io.Writer) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "doctor":
+			return runDoctor(stdout)
+		case "scan":
+			return runScan(args[1:], stdout, stderr)
+		case "serve":
+			return runServe(args[1:], os.Stdin, stdout, stderr)
+		case "regexes":
+			return runRegexes(args[1:], stdout, stderr)
+		}
 	}
 
-	definitionFile := os.Args[1]
+	fs := flag.NewFlagSet("honeycomb-linter", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	cpuProfile := fs.String("cpuprofile", "", "write a CPU profile of the run to `file`")
+	memProfile := fs.String("memprofile", "", "write a memory profile at the end of the run to `file`")
+	optFlags := addOptionFlags(fs)
+	summaryOut := fs.String("summary-out", "", "write a JSON summary of the run to `file`")
+	failOnWarn := fs.Bool("fail-on-warn", false, "exit non-zero if any warning is reported")
+	groupBy := fs.String("group-by", "file", "how to organize the report: file, or rule to list each rule's hits together")
+	ruleStats := fs.Bool("rule-stats", false, "print how many times each warning rule fired across all inputs")
+	outputDir := fs.String("output-dir", "", "write each input's report to a file under `dir`, mirroring the input's path, instead of stdout")
+	junitOut := fs.String("junit-out", "", "write a JUnit XML report to `file` (- for stdout, replacing the text output)")
+	var out outputConfig
+	fs.BoolVar(&out.onlyErrors, "only-errors", false, "print errors only; warnings still count towards the exit code")
+	fs.BoolVar(&out.onlyWarnings, "only-warnings", false, "print warnings only; errors still count towards the exit code and stay failures in the JUnit report")
+	fs.StringVar(&out.positionEncoding, "position-encoding", "byte", "how to report positions: byte, utf16 or linecol")
+	fs.BoolVar(&out.verbose, "verbose", false, "also print the description each condition gives in a trailing # comment")
+	fs.BoolVar(&out.oneline, "oneline", false, "print one file:line:col: severity: message line per problem and nothing for valid files, for editors and pre-commit hooks")
+	eJSON := fs.String("e-json", "", "validate the condition field of this inline JSON `object`, e.g. '{\"condition\": \"$a = 1\"}'")
+	var in inputConfig
+	fs.StringVar(&in.format, "format", "text", "input `format`: text (the whole file is one condition), csv, tsv, markdown (honeycomb code blocks) or json (an array of conditions)")
+	fs.StringVar(&in.column, "column", "", "CSV/TSV `column` holding the conditions: a header name, or a 1-based number with -header=false")
+	fs.BoolVar(&in.header, "header", true, "treat the first CSV/TSV row as a header")
+	fs.StringVar(&in.decode, "decode", "", "`encoding` of each condition, e.g. base64")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: honeycomb-linter [flags] <filename>...")
+		fmt.Fprintln(stderr, "       honeycomb-linter [flags] -e-json <object>")
+		fmt.Fprintln(stderr, "       honeycomb-linter scan --manifest <file>")
+		fmt.Fprintln(stderr, "       honeycomb-linter serve [flags] < requests")
+		fmt.Fprintln(stderr, "       honeycomb-linter regexes [flags] <filename>...")
+		fmt.Fprintln(stderr, "       honeycomb-linter doctor")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 1
+	}
 
-	definition, err := ioutil.ReadFile(definitionFile)
+	if fs.NArg() < 1 && *eJSON == "" {
+		fs.Usage()
+		return 1
+	}
+	if out.onlyErrors && out.onlyWarnings {
+		fmt.Fprintln(stderr, "--only-errors and --only-warnings are mutually exclusive")
+		return 1
+	}
+	opts, err := optFlags.options()
 	if err != nil {
-		fmt.Println("Error reading file:", err)
-		os.Exit(1)
+		return optionsFailed(stderr, err)
+	}
+	switch out.positionEncoding {
+	case "byte", "utf16", "linecol":
+	default:
+		fmt.Fprintf(stderr, "unknown --position-encoding %q\n", out.positionEncoding)
+		return 1
+	}
+	if (in.format == "csv" || in.format == "tsv") && in.column == "" {
+		fmt.Fprintf(stderr, "--column is required for %s input\n", in.format)
+		return 1
+	}
+	if in.decode != "" && in.decode != "base64" {
+		fmt.Fprintf(stderr, "unknown --decode encoding %q\n", in.decode)
+		return 1
+	}
+	switch *groupBy {
+	case "file":
+	case "rule":
+		if *outputDir != "" {
+			fmt.Fprintln(stderr, "--group-by rule cannot be combined with --output-dir")
+			return 1
+		}
+	default:
+		fmt.Fprintf(stderr, "unknown --group-by %q\n", *groupBy)
+		return 1
 	}
 
-	// Check if the condition is valid for "definition"
-	_, err = ParseCondition(string(definition))
+	if *cpuProfile != "" {
+		f, err := os.Create(*cpuProfile)
+		if err != nil {
+			fmt.Fprintln(stderr, "Error creating CPU profile:", err)
+			return 1
+		}
+		defer f.Close()
+		if err := pprof.StartCPUProfile(f); err != nil {
+			fmt.Fprintln(stderr, "Error starting CPU profile:", err)
+			return 1
+		}
+		defer pprof.StopCPUProfile()
+	}
+
+	text := stdout
+	if *junitOut == "-" {
+		text = ioutil.Discard
+	}
+	perFile := text
+	if *groupBy == "rule" {
+		perFile = ioutil.Discard
+	}
+
+	start := time.Now()
+	var sum summary
+	var report junitReport
+	hits := make(map[string]int)
+	var byRule ruleReport
+	code := 0
+	// An inline -e-json condition is reported first, under the flag's name.
+	inputs := fs.Args()
+	if *eJSON != "" {
+		inputs = append([]string{"-e-json"}, inputs...)
+	}
+	for i, definitionFile := range inputs {
+		sum.Files++
+		var res fileResult
+		switch {
+		case *eJSON != "" && i == 0:
+			res = lintInlineJSON(perFile, definitionFile, *eJSON, in, out, opts...)
+		case *outputDir != "":
+			var buf bytes.Buffer
+			res = lintFile(&buf, definitionFile, in, out, opts...)
+			if err := writeReport(*outputDir, definitionFile, buf.Bytes()); err != nil {
+				fmt.Fprintln(stderr, "Error writing report:", err)
+				code = 1
+			}
+		default:
+			res = lintFile(perFile, definitionFile, in, out, opts...)
+		}
+		report.add(definitionFile, res, out)
+		byRule.add(definitionFile, res)
+		for _, e := range res.entries {
+			for _, w := range e.warnings {
+				hits[w.Rule]++
+			}
+		}
+		if res.errors > 0 {
+			sum.Failed++
+			code = 1
+		} else {
+			sum.Passed++
+		}
+		if *failOnWarn && res.warnings > 0 {
+			code = 1
+		}
+	}
+	sum.Rules = hits
+	sum.DurationMS = time.Since(start).Milliseconds()
+
+	if *groupBy == "rule" {
+		byRule.write(text, out)
+	}
+	if *ruleStats {
+		writeRuleStats(text, hits)
+	}
+
+	if *junitOut != "" {
+		report.duration = time.Since(start)
+		if err := report.write(*junitOut, stdout); err != nil {
+			fmt.Fprintln(stderr, "Error writing JUnit report:", err)
+			code = 1
+		}
+	}
+
+	if *summaryOut != "" {
+		if err := writeSummary(*summaryOut, sum); err != nil {
+			fmt.Fprintln(stderr, "Error writing summary:", err)
+			code = 1
+		}
+	}
+
+	if *memProfile != "" {
+		if err := writeMemProfile(*memProfile); err != nil {
+			fmt.Fprintln(stderr, "Error writing memory profile:", err)
+			code = 1
+		}
+	}
+
+	return code
+}
+
+// writeRuleStats prints the number of times each rule fired, most frequent
+// first. Rules that never fired are not listed.
+func writeRuleStats(w io.Writer, hits map[string]int) {
+	rules := make([]string, 0, len(hits))
+	for rule := range hits {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if hits[rules[i]] != hits[rules[j]] {
+			return hits[rules[i]] > hits[rules[j]]
+		}
+		return rules[i] < rules[j]
+	})
+	fmt.Fprintln(w, "Rule hits:")
+	if len(rules) == 0 {
+		fmt.Fprintln(w, "  (none)")
+	}
+	for _, rule := range rules {
+		fmt.Fprintf(w, "  %-24s %d\n", rule, hits[rule])
+	}
+}
+
+// ruleReport collects diagnostics across files for --group-by rule.
+type ruleReport struct {
+	errors []located
+	rules  map[string][]located
+}
+
+// located is an error or warning with the file and entry it came from.
+type located struct {
+	where   string
+	err     error
+	warning Warning
+}
+
+// add records the diagnostics of one file.
+func (r *ruleReport) add(definitionFile string, res fileResult) {
+	if r.rules == nil {
+		r.rules = make(map[string][]located)
+	}
+	for _, e := range res.entries {
+		where := definitionFile
+		if e.location != "" {
+			where += " (" + e.location + ")"
+		}
+		if e.err != nil {
+			r.errors = append(r.errors, located{where: where, err: e.err})
+		}
+		for _, w := range e.warnings {
+			r.rules[w.Rule] = append(r.rules[w.Rule], located{where: where, warning: w})
+		}
+	}
+}
+
+// write prints the errors, then each rule's warnings with their count,
+// rules in alphabetical order.
+func (r *ruleReport) write(w io.Writer, out outputConfig) {
+	if len(r.errors) == 0 && len(r.rules) == 0 {
+		fmt.Fprintln(w, "All definitions are valid!")
+		return
+	}
+	if !out.onlyWarnings && len(r.errors) > 0 {
+		fmt.Fprintf(w, "Invalid definitions (%d):\n", len(r.errors))
+		for _, e := range r.errors {
+			fmt.Fprintf(w, "  %s: %s\n", e.where, describeError(e.err, out.positionEncoding))
+		}
+	}
+	if out.onlyErrors {
+		return
+	}
+	rules := make([]string, 0, len(r.rules))
+	for rule := range r.rules {
+		rules = append(rules, rule)
+	}
+	sort.Strings(rules)
+	for _, rule := range rules {
+		fmt.Fprintf(w, "%s %s (%d):\n", ruleCodes[rule], rule, len(r.rules[rule]))
+		for _, hit := range r.rules[rule] {
+			ww := hit.warning
+			fmt.Fprintf(w, "  %s: %s (%s)\n", hit.where, ww.Message, formatPosition(out.positionEncoding, ww.Pos, ww.Line, ww.Column, ww.UTF16Pos))
+		}
+	}
+}
+
+// optionFlags are the flags that map to an Option. Every subcommand that
+// lints conditions registers them, so the same condition is read the same
+// way whichever one checks it.
+type optionFlags struct {
+	allowPlaceholders    bool
+	allowWildcards       bool
+	sigils               string
+	numericCommas        bool
+	units                bool
+	coerceNumericStrings bool
+	maxInItems           int
+	maxLength            int
+	warnUnanchored       bool
+	disable              string
+}
+
+// addOptionFlags registers the option flags on fs.
+func addOptionFlags(fs *flag.FlagSet) *optionFlags {
+	f := &optionFlags{}
+	fs.BoolVar(&f.allowPlaceholders, "allow-placeholders", false, "accept ${...} template placeholders as operands")
+	fs.BoolVar(&f.allowWildcards, "allow-wildcards", false, "accept field wildcards, $* and $prefix.*, as operands")
+	fs.StringVar(&f.sigils, "sigil", "$", "`characters` that start a field reference, e.g. $@")
+	fs.BoolVar(&f.numericCommas, "numeric-commas", false, "read numbers with thousands separators, like 1,000, as one literal")
+	fs.BoolVar(&f.units, "units", false, "accept unit suffixes on numbers, like 5k, 1KB or 2MiB")
+	fs.BoolVar(&f.coerceNumericStrings, "coerce-numeric-strings", false, "accept numeric strings in ordering comparisons, like $duration > \"500\", as numbers (with a warning)")
+	fs.IntVar(&f.maxInItems, "max-in-items", 50, "warn about IN lists with more than `n` values (0 disables)")
+	fs.IntVar(&f.maxLength, "max-length", defaultMaxLength, "warn about conditions longer than `n` characters once whitespace is normalized (0 disables)")
+	fs.BoolVar(&f.warnUnanchored, "warn-unanchored", false, "warn about path-like =~ patterns without a ^ anchor")
+	fs.StringVar(&f.disable, "disable", "", "comma-separated warning `rules` to disable, by name or code")
+	return f
+}
+
+// options returns the Options the parsed flags ask for.
+func (f *optionFlags) options() ([]Option, error) {
+	if err := checkSigils(f.sigils); err != nil {
+		return nil, err
+	}
+	opts := []Option{
+		WithPlaceholders(f.allowPlaceholders),
+		WithWildcards(f.allowWildcards),
+		WithNumericCommas(f.numericCommas),
+		WithUnits(f.units),
+		WithNumericStringCoercion(f.coerceNumericStrings),
+		WithFieldSigil([]byte(f.sigils)...),
+		WithMaxInItems(f.maxInItems),
+		WithMaxLength(f.maxLength),
+		WithAnchorCheck(f.warnUnanchored),
+	}
+	if f.disable != "" {
+		rules := strings.Split(f.disable, ",")
+		for _, rule := range rules {
+			if err := checkRule(rule); err != nil {
+				return nil, fmt.Errorf("--disable: %w", err)
+			}
+		}
+		opts = append(opts, WithDisabledRules(rules...))
+	}
+	return opts, nil
+}
+
+// optionsFailed prints err from optionFlags.options and returns the exit
+// code for it: 2 for an unknown rule, which is a usage mistake, and 1
+// otherwise.
+func optionsFailed(stderr io.Writer, err error) int {
+	fmt.Fprintln(stderr, err)
+	if errors.Is(err, errUnknownRule) {
+		return 2
+	}
+	return 1
+}
+
+// checkSigils reports an error if any of sigils could not start a field
+// reference because it already means something else in a condition.
+func checkSigils(sigils string) error {
+	for i := 0; i < len(sigils); i++ {
+		if ch := sigils[i]; isIdentChar(ch) || isOperator(ch) || isWhitespace(ch) || strings.IndexByte("`\"-", ch) >= 0 {
+			return fmt.Errorf("%q cannot be used as a field sigil", ch)
+		}
+	}
+	return nil
+}
+
+// outputConfig controls what lintFile prints.
+type outputConfig struct {
+	onlyErrors       bool
+	onlyWarnings     bool
+	positionEncoding string
+	oneline          bool // file:line:col: lines for editors and hooks
+	verbose          bool // also print each condition's description
+}
+
+// fileResult counts what lintFile reported for one file.
+type fileResult struct {
+	errors   int
+	warnings int
+	entries  []entryResult
+}
+
+// entryResult is the outcome for one condition of a file. A file that could
+// not be read is recorded as a single entry with no location.
+type entryResult struct {
+	location string
+	err      error
+	warnings []Warning
+}
+
+// lintFile validates the definitions in definitionFile and prints the
+// outcome to w.
+func lintFile(w io.Writer, definitionFile string, in inputConfig, out outputConfig, opts ...Option) fileResult {
+	var res fileResult
+	entries, err := readEntries(definitionFile, in)
 	if err != nil {
-		fmt.Printf("Invalid derived column definition in file %s:\n%s\n", definitionFile, err)
-		os.Exit(1)
+		if out.oneline {
+			fmt.Fprintf(w, "%s: error: %v\n", definitionFile, err)
+		} else {
+			fmt.Fprintln(w, "Error reading file:", err)
+		}
+		res.errors++
+		res.entries = append(res.entries, entryResult{err: err})
+		return res
 	}
+	return lintEntries(w, definitionFile, entries, in, out, opts...)
+}
 
-	fmt.Println("Definition is valid!")
+// lintInlineJSON validates the condition field of a JSON-encoded Definition
+// given on the command line, reporting it under name.
+func lintInlineJSON(w io.Writer, name, data string, in inputConfig, out outputConfig, opts ...Option) fileResult {
+	var fields map[string]json.RawMessage
+	var def Definition
+	err := json.Unmarshal([]byte(data), &fields)
+	if err == nil {
+		err = json.Unmarshal([]byte(data), &def)
+	}
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &typeErr) && typeErr.Field == "":
+		err = fmt.Errorf("expected a JSON object, got %s", typeErr.Value)
+	case typeErr != nil:
+		err = fmt.Errorf("%q must be a string, got %s", typeErr.Field, typeErr.Value)
+	case err != nil:
+		err = fmt.Errorf("invalid JSON: %v", err)
+	case fields["condition"] == nil:
+		err = fmt.Errorf("JSON object has no \"condition\" field")
+	}
+	if err != nil {
+		fmt.Fprintf(w, "Error reading %s: %v\n", name, err)
+		return fileResult{errors: 1, entries: []entryResult{{err: err}}}
+	}
+	return lintEntries(w, name, []entry{{condition: def.Condition, line: 1, column: 1}}, in, out, opts...)
+}
+
+// lintEntries validates the conditions read from definitionFile and prints
+// the outcome to w.
+func lintEntries(w io.Writer, definitionFile string, entries []entry, in inputConfig, out outputConfig, opts ...Option) fileResult {
+	var res fileResult
+	showErrors := !out.onlyWarnings
+	showWarnings := !out.onlyErrors
+
+	for _, e := range entries {
+		where := definitionFile
+		if e.location != "" {
+			where += " (" + e.location + ")"
+		}
+		lint, err := lintEntry(e, in, opts...)
+		if out.verbose && !out.oneline && lint != nil && lint.Description != "" {
+			fmt.Fprintf(w, "Description of derived column definition in file %s: %s\n", where, lint.Description)
+		}
+		if err != nil {
+			if showErrors && out.oneline {
+				line, column := e.line, e.column
+				var ve *ValidationError
+				if errors.As(err, &ve) {
+					line, column = filePosition(e, in, ve.Line, ve.Column)
+					err = fmt.Errorf("%s [%s]", ve.Message, ve.Code)
+				}
+				fmt.Fprintf(w, "%s:%d:%d: error: %v\n", definitionFile, line, column, err)
+			} else if showErrors {
+				fmt.Fprintf(w, "Invalid derived column definition in file %s:\n%s\n", where, describeError(err, out.positionEncoding))
+			}
+			res.errors++
+			res.entries = append(res.entries, entryResult{location: e.location, err: err})
+			continue
+		}
+		res.entries = append(res.entries, entryResult{location: e.location, warnings: lint.Warnings})
+		for _, warning := range lint.Warnings {
+			if showWarnings && out.oneline {
+				line, column := filePosition(e, in, warning.Line, warning.Column)
+				fmt.Fprintf(w, "%s:%d:%d: warning: %s [%s %s]\n", definitionFile, line, column, warning.Message, warning.Code, warning.Rule)
+			} else if showWarnings {
+				fmt.Fprintf(w, "Warning for derived column definition in file %s:\n%s\n", where, describeWarning(warning, out.positionEncoding))
+			}
+			res.warnings++
+		}
+	}
+
+	if res.errors == 0 && !out.oneline {
+		fmt.Fprintf(w, "Definition in file %s is valid!\n", definitionFile)
+	}
+	return res
+}
+
+// filePosition converts a line and column within the condition of e to a
+// line and column in its file. Positions in an encoded condition, or in a
+// JSON string with escapes, refer to the decoded text, so those are
+// reported at the start of the condition.
+func filePosition(e entry, in inputConfig, line, column int) (int, int) {
+	if in.decode != "" || e.escaped {
+		return e.line, e.column
+	}
+	if e.quoted {
+		// Every '"' before the position on its line takes two columns.
+		lines := strings.Split(e.condition, "\n")
+		if line <= len(lines) {
+			chars, quotes := 0, 0
+			for _, r := range lines[line-1] {
+				if chars == column-1 {
+					break
+				}
+				if r == '"' {
+					quotes++
+				}
+				chars++
+			}
+			column += quotes
+		}
+	}
+	if line == 1 {
+		return e.line, e.column + column - 1
+	}
+	return e.line + line - 1, column
+}
+
+// writeReport writes the report for definitionFile to dir, at the input's
+// path relative to the working directory with ".lint.txt" appended. Inputs
+// outside the working directory are refused rather than written outside dir.
+func writeReport(dir, definitionFile string, report []byte) error {
+	abs, err := filepath.Abs(definitionFile)
+	if err != nil {
+		return err
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(wd, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%s is outside the working directory; cannot mirror it under %s", definitionFile, dir)
+	}
+
+	path := filepath.Join(dir, rel+".lint.txt")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, report, 0644)
+}
+
+// lintEntry decodes and lints a single condition read from an input file.
+func lintEntry(e entry, in inputConfig, opts ...Option) (*Result, error) {
+	if e.err != nil {
+		return nil, e.err
+	}
+	condition, err := decodeCondition(e.condition, in)
+	if err != nil {
+		return nil, err
+	}
+	// Check if the condition is valid for "definition"
+	return Lint(condition, opts...)
+}
+
+func writeMemProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	runtime.GC() // get up-to-date statistics
+	return pprof.WriteHeapProfile(f)
 }
 
 type Token int
@@ -39,7 +592,7 @@ type Token int
 const (
 	ILLEGAL Token = iota
 	EOF
-	WHITESPACE
+	COMMA
 	AND
 	OR
 	NOT
@@ -54,34 +607,126 @@ const (
 	LTE
 	GT
 	GTE
+	IDENT
+	BOOLEAN
+	NUMBER
+	STRING
+	NULL
+	COALESCE
 )
 
-var keywords = map[string]Token{
-	"AND":    AND,
-	"OR":     OR,
-	"NOT":    NOT,
-	"=":      EQUALS,
-	"!=":     NOT_EQUALS,
-	"=~":     REG_MATCH,
-	"EXISTS": EXISTS,
-	"IN":     IN,
-	"<":      LT,
-	"<=":     LTE,
-	">":      GT,
-	">=":     GTE,
+// lookupKeyword returns the token for a reserved word. This is on the hot
+// path for every bare word, and a switch avoids hashing the word as a map
+// lookup would.
+func lookupKeyword(word string) (Token, bool) {
+	switch word {
+	case "AND":
+		return AND, true
+	case "OR":
+		return OR, true
+	case "NOT":
+		return NOT, true
+	case "EXISTS":
+		return EXISTS, true
+	case "IN":
+		return IN, true
+	case "true", "false":
+		return BOOLEAN, true
+	case "null":
+		return NULL, true
+	}
+	return ILLEGAL, false
+}
+
+// Option configures how conditions are lexed and validated.
+type Option func(*config)
+
+type config struct {
+	allowPlaceholders    bool
+	maxInItems           int
+	disabled             map[string]bool
+	instrument           bool
+	numericCommas        bool
+	sigils               string
+	anchorCheck          bool
+	units                bool
+	maxLength            int
+	allowWildcards       bool
+	coerceNumericStrings bool
+	err                  error // the first invalid option, returned by Lint
+}
+
+func newConfig(opts []Option) config {
+	c := config{maxInItems: 50, maxLength: defaultMaxLength, sigils: "$"}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// WithPlaceholders makes ${...} template placeholders valid operands. Their
+// contents are not inspected.
+func WithPlaceholders(allow bool) Option {
+	return func(c *config) {
+		c.allowPlaceholders = allow
+	}
+}
+
+// WithWildcards makes field references ending in a wildcard, $* or
+// $prefix.*, valid operands.
+func WithWildcards(allow bool) Option {
+	return func(c *config) {
+		c.allowWildcards = allow
+	}
+}
+
+// WithNumericStringCoercion makes ordering comparisons accept a string
+// literal that holds a number, like $duration > "500", as that number. The
+// numeric-string rule still warns about it. Without it, such a comparison
+// is an error.
+func WithNumericStringCoercion(enabled bool) Option {
+	return func(c *config) {
+		c.coerceNumericStrings = enabled
+	}
 }
 
 type Lexer struct {
-	input string
-	pos   int
+	cfg     config
+	input   string
+	pos     int
+	start   int    // offset of the token returned by the last NextToken call
+	lit     string // field name or literal text of the last token
+	quoted  bool   // whether the last IDENT was backtick-quoted
+	sigil   byte   // sigil before the last unquoted IDENT, or 0 for a bare word
+	comment string // text of the trailing # comment, if any
+	codeEnd int    // offset where the trailing # comment starts, if any
+	err     error  // set when NextToken returns ILLEGAL for a known reason
+}
+
+// ValidationError reports a problem at a byte offset in the condition.
+type ValidationError struct {
+	Pos      int    // byte offset
+	Line     int    // 1-based line
+	Column   int    // 1-based column, in characters
+	UTF16Pos int    // offset in UTF-16 code units
+	Code     string // stable identifier of the kind of error; see codes.go
+	Message  string
 }
 
-func NewLexer(input string) *Lexer {
-	return &Lexer{input: input}
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s (at offset %d)", e.Message, e.Pos)
+}
+
+func NewLexer(input string, opts ...Option) *Lexer {
+	return &Lexer{input: input, cfg: newConfig(opts)}
 }
 
 func (l *Lexer) NextToken() Token {
 	l.skipWhitespace()
+	l.start = l.pos
+	l.lit = ""
+	l.quoted = false
+	l.sigil = 0
 
 	if l.pos >= len(l.input) {
 		return EOF
@@ -90,7 +735,20 @@ func (l *Lexer) NextToken() Token {
 	ch := l.input[l.pos]
 	l.pos++
 
+	if ch == '$' && l.peek() == '{' {
+		return l.readPlaceholder()
+	}
+	if strings.IndexByte(l.cfg.sigils, ch) >= 0 {
+		if l.peek() == '`' {
+			l.pos++
+			return l.readQuotedIdentifier()
+		}
+		return l.readIdentifier()
+	}
+
 	switch ch {
+	case '#':
+		return l.readComment()
 	case '(':
 		return LPAREN
 	case ')':
@@ -108,7 +766,20 @@ func (l *Lexer) NextToken() Token {
 		}
 		return NOT
 	case ',':
-		return WHITESPACE
+		return COMMA
+	case '`':
+		return l.readQuotedIdentifier()
+	case '"':
+		return l.readString()
+	case '-':
+		if isDigit(l.peek()) {
+			return l.readNumber()
+		}
+	case '?':
+		if l.peek() == '?' {
+			l.pos++
+			return COALESCE
+		}
 	case '<':
 		if l.peek() == '=' {
 			l.pos++
@@ -125,8 +796,13 @@ func (l *Lexer) NextToken() Token {
 		if isLetter(ch) {
 			return l.readKeyword()
 		}
-		return ILLEGAL
+		if isDigit(ch) {
+			return l.readNumber()
+		}
 	}
+
+	l.err = &ValidationError{Pos: l.start, Code: codeUnexpectedCharacter, Message: fmt.Sprintf("unexpected character %q", ch)}
+	return ILLEGAL
 }
 
 func (l *Lexer) skipWhitespace() {
@@ -146,27 +822,288 @@ func (l *Lexer) peek() byte {
 	return l.input[l.pos]
 }
 
+// readKeyword reads a bare word. Words that are not keywords are field names.
 func (l *Lexer) readKeyword() Token {
 	start := l.pos - 1
-	for l.pos < len(l.input) && isLetter(l.input[l.pos]) {
+	for l.pos < len(l.input) && isIdentChar(l.input[l.pos]) {
 		l.pos++
 	}
 	word := l.input[start:l.pos]
 
-	if tok, ok := keywords[word]; ok {
+	if tok, ok := lookupKeyword(word); ok {
+		if isLiteral(tok) {
+			l.lit = word
+		}
 		return tok
 	}
-	fmt.Println(word)
 
-	return ILLEGAL
+	return l.readIdentifier()
 }
 
-func (l *Lexer) readIdentifier() string {
-	start := l.pos - 1
-	for l.pos < len(l.input) && isLetter(l.input[l.pos]) {
+// readIdentifier reads an unquoted field name starting at l.start, with or
+// without a leading sigil. Bare field names may only contain letters, digits,
+// '_' and '.'; anything else has to be backtick-quoted.
+func (l *Lexer) readIdentifier() Token {
+	for l.pos < len(l.input) && !isWhitespace(l.input[l.pos]) && !isOperator(l.input[l.pos]) && l.input[l.pos] != '#' {
 		l.pos++
 	}
-	return l.input[start:l.pos]
+	name := l.input[l.start:l.pos]
+	if sigil := name[0]; !isLetter(sigil) {
+		l.sigil = sigil
+		name = name[1:]
+		if name == "" {
+			l.err = &ValidationError{Pos: l.start, Code: codeMissingFieldName, Message: fmt.Sprintf("'%c' must be followed by a field name", sigil)}
+			return ILLEGAL
+		}
+	}
+	// A trailing * stands for any field, or any field under a dotted
+	// prefix: $* or $http.*.
+	check := name
+	if name == "*" || strings.HasSuffix(name, ".*") {
+		if !l.cfg.allowWildcards {
+			l.err = &ValidationError{Pos: l.start, Code: codeWildcardNotAllowed, Message: fmt.Sprintf("field wildcard %q is not allowed; pass --allow-wildcards", name)}
+			return ILLEGAL
+		}
+		check = strings.TrimSuffix(strings.TrimSuffix(name, "*"), ".")
+		if name != "*" && (check == "" || strings.HasSuffix(check, ".")) {
+			l.err = &ValidationError{Pos: l.start, Code: codeInvalidWildcard, Message: fmt.Sprintf("field wildcard %q needs a field name before \".*\"", name)}
+			return ILLEGAL
+		}
+	}
+	for i := 0; i < len(check); i++ {
+		if !isIdentChar(check[i]) {
+			r, _ := utf8.DecodeRuneInString(check[i:])
+			l.err = &ValidationError{
+				Pos:     l.pos - len(name) + i,
+				Code:    codeInvalidFieldChar,
+				Message: fmt.Sprintf("invalid character %q in field name %q; quote it with backticks: %s`%s`", r, name, l.cfg.suggestSigil(l.sigil), name),
+			}
+			return ILLEGAL
+		}
+	}
+	l.lit = name
+	return IDENT
+}
+
+// suggestSigil returns the sigil to write before a field in a suggested
+// fix: sigil if the input used one, else the first configured sigil.
+func (c *config) suggestSigil(sigil byte) string {
+	if sigil != 0 {
+		return string(sigil)
+	}
+	if c.sigils == "" {
+		return ""
+	}
+	return c.sigils[:1]
+}
+
+// WithFieldSigil sets the characters that introduce a field reference, in
+// place of the default '$'. Bare field names are accepted either way.
+func WithFieldSigil(sigils ...byte) Option {
+	return func(c *config) {
+		c.sigils = string(sigils)
+	}
+}
+
+// WithUnits makes the lexer accept SI and byte-size suffixes on numbers,
+// such as 5k or 2MiB, applying the multiplier to the literal.
+func WithUnits(enabled bool) Option {
+	return func(c *config) {
+		c.units = enabled
+	}
+}
+
+// WithNumericCommas makes the lexer read numbers written with thousands
+// separators, such as 1,000, as a single literal.
+func WithNumericCommas(enabled bool) Option {
+	return func(c *config) {
+		c.numericCommas = enabled
+	}
+}
+
+// readComment reads a # comment, which runs to the end of the line and must
+// end the condition: only whitespace may follow it. The '#' has already been
+// consumed. The comment's text is kept as the condition's description.
+func (l *Lexer) readComment() Token {
+	end := strings.IndexByte(l.input[l.pos:], '\n')
+	if end < 0 {
+		end = len(l.input)
+	} else {
+		end += l.pos
+	}
+	l.comment = strings.TrimSpace(l.input[l.pos:end])
+	if rest := strings.TrimSpace(l.input[end:]); rest != "" {
+		l.err = &ValidationError{Pos: l.start, Code: codeCommentNotTrailing, Message: "a # comment must come at the end of the condition"}
+		return ILLEGAL
+	}
+	l.codeEnd = l.start
+	l.pos = len(l.input)
+	return EOF
+}
+
+// code returns the input without its trailing # comment, if any.
+func (l *Lexer) code() string {
+	if l.codeEnd > 0 {
+		return l.input[:l.codeEnd]
+	}
+	return l.input
+}
+
+// readPlaceholder reads a ${...} template placeholder as an opaque operand.
+// The '$' has already been consumed.
+func (l *Lexer) readPlaceholder() Token {
+	if !l.cfg.allowPlaceholders {
+		l.err = &ValidationError{Pos: l.start, Code: codePlaceholder, Message: "template placeholder \"${\" is not allowed; render the template first or pass --allow-placeholders"}
+		return ILLEGAL
+	}
+	end := strings.IndexByte(l.input[l.pos:], '}')
+	if end < 0 {
+		l.err = &ValidationError{Pos: l.start, Code: codeUnterminatedTemplate, Message: "unterminated template placeholder"}
+		l.pos = len(l.input)
+		return ILLEGAL
+	}
+	l.pos += end + 1
+	l.lit = l.input[l.start:l.pos]
+	return IDENT
+}
+
+// readNumber reads an integer or decimal literal, optionally negative.
+func (l *Lexer) readNumber() Token {
+	for l.pos < len(l.input) && isDigit(l.input[l.pos]) {
+		l.pos++
+	}
+	if l.cfg.numericCommas && !l.readThousands() {
+		return ILLEGAL
+	}
+	if l.peek() == '.' {
+		l.pos++
+		for l.pos < len(l.input) && isDigit(l.input[l.pos]) {
+			l.pos++
+		}
+	}
+	number := strings.ReplaceAll(l.input[l.start:l.pos], ",", "")
+	if l.pos < len(l.input) && isIdentChar(l.input[l.pos]) {
+		suffixStart := l.pos
+		for l.pos < len(l.input) && isIdentChar(l.input[l.pos]) {
+			l.pos++
+		}
+		if !l.cfg.units {
+			l.err = &ValidationError{Pos: l.start, Code: codeInvalidNumber, Message: fmt.Sprintf("invalid number %q", l.input[l.start:l.pos])}
+			return ILLEGAL
+		}
+		suffix := l.input[suffixStart:l.pos]
+		multiplier, ok := unitMultipliers[suffix]
+		if !ok {
+			l.err = &ValidationError{
+				Pos:     suffixStart,
+				Code:    codeUnknownUnit,
+				Message: fmt.Sprintf("unknown unit %q; supported units are %s", suffix, strings.Join(unitNames(), ", ")),
+			}
+			return ILLEGAL
+		}
+		v, err := strconv.ParseFloat(number, 64)
+		if err != nil {
+			l.err = &ValidationError{Pos: l.start, Code: codeInvalidNumber, Message: fmt.Sprintf("invalid number %q", l.input[l.start:l.pos])}
+			return ILLEGAL
+		}
+		number = strconv.FormatFloat(v*multiplier, 'f', -1, 64)
+	}
+	l.lit = number
+	return NUMBER
+}
+
+// unitMultipliers are the suffixes accepted on numbers with WithUnits: SI
+// prefixes, and decimal and binary byte sizes.
+var unitMultipliers = map[string]float64{
+	"k":   1e3,
+	"M":   1e6,
+	"G":   1e9,
+	"T":   1e12,
+	"B":   1,
+	"KB":  1e3,
+	"MB":  1e6,
+	"GB":  1e9,
+	"TB":  1e12,
+	"KiB": 1 << 10,
+	"MiB": 1 << 20,
+	"GiB": 1 << 30,
+	"TiB": 1 << 40,
+}
+
+func unitNames() []string {
+	var names []string
+	for name := range unitMultipliers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// readThousands extends the integer part of a number over ",ddd" digit
+// groups, as in 1,000,000. A comma directly followed by a digit that does not
+// fit that pattern is ambiguous and reported. A comma followed by anything
+// else is left alone as a separator.
+func (l *Lexer) readThousands() bool {
+	lead := l.pos - l.start
+	if l.input[l.start] == '-' {
+		lead--
+	}
+	for l.peek() == ',' && l.pos+1 < len(l.input) && isDigit(l.input[l.pos+1]) {
+		end := l.pos + 1
+		for end < len(l.input) && isDigit(l.input[end]) {
+			end++
+		}
+		if lead > 3 || end-l.pos-1 != 3 {
+			l.err = &ValidationError{
+				Pos:     l.pos,
+				Code:    codeAmbiguousComma,
+				Message: fmt.Sprintf("ambiguous comma in number %q; thousands separators must separate groups of three digits", l.input[l.start:end]),
+			}
+			return false
+		}
+		l.pos = end
+		lead = 3
+	}
+	return true
+}
+
+// readString reads a double-quoted string literal, keeping the quotes in
+// l.lit. The opening quote has already been consumed.
+func (l *Lexer) readString() Token {
+	for l.pos < len(l.input) {
+		switch l.input[l.pos] {
+		case '\\':
+			l.pos += 2
+			continue
+		case '"':
+			l.pos++
+			l.lit = l.input[l.start:l.pos]
+			return STRING
+		}
+		l.pos++
+	}
+	l.err = &ValidationError{Pos: l.start, Code: codeUnterminatedString, Message: "unterminated string"}
+	l.pos = len(l.input)
+	return ILLEGAL
+}
+
+// readQuotedIdentifier reads a backtick-quoted field name. The opening
+// backtick has already been consumed.
+func (l *Lexer) readQuotedIdentifier() Token {
+	end := strings.IndexByte(l.input[l.pos:], '`')
+	if end < 0 {
+		l.err = &ValidationError{Pos: l.start, Code: codeUnterminatedQuoted, Message: "unterminated quoted field name"}
+		l.pos = len(l.input)
+		return ILLEGAL
+	}
+	l.lit = l.input[l.pos : l.pos+end]
+	l.pos += end + 1
+	if l.lit == "" {
+		l.err = &ValidationError{Pos: l.start, Code: codeEmptyQuotedField, Message: "empty quoted field name"}
+		return ILLEGAL
+	}
+	l.quoted = true
+	return IDENT
 }
 
 func (l *Lexer) readLiteral() string {
@@ -182,7 +1119,7 @@ func isWhitespace(ch byte) bool {
 }
 
 func isOperator(ch byte) bool {
-	return ch == '(' || ch == ')' || ch == ',' || ch == '=' || ch == '!' || ch == '<' || ch == '>'
+	return ch == '(' || ch == ')' || ch == ',' || ch == '=' || ch == '!' || ch == '<' || ch == '>' || ch == '?'
 }
 
 func isLetter(ch byte) bool {
@@ -193,66 +1130,619 @@ func isDigit(ch byte) bool {
 	return ch >= '0' && ch <= '9'
 }
 
-func ParseCondition(input string) (string, error) {
-	l := NewLexer(input)
+func isOperand(tok Token) bool {
+	return tok == IDENT || isLiteral(tok)
+}
+
+func isComparison(tok Token) bool {
+	return tok == EQUALS || tok == NOT_EQUALS || isOrdering(tok)
+}
+
+func isLiteral(tok Token) bool {
+	return tok == BOOLEAN || tok == NUMBER || tok == STRING || tok == NULL
+}
+
+func connective(tok Token) string {
+	if tok == OR {
+		return "OR"
+	}
+	return "AND"
+}
+
+// isBinary reports whether tok is an operator that takes a left operand.
+func isBinary(tok Token) bool {
+	switch tok {
+	case AND, OR, EQUALS, NOT_EQUALS, REG_MATCH, COALESCE:
+		return true
+	}
+	return isOrdering(tok)
+}
+
+// operatorText returns how a binary operator is written.
+func operatorText(tok Token) string {
+	switch tok {
+	case AND, OR:
+		return connective(tok)
+	case EQUALS:
+		return "="
+	case NOT_EQUALS:
+		return "!="
+	case REG_MATCH:
+		return "=~"
+	case COALESCE:
+		return "??"
+	case LT:
+		return "<"
+	case LTE:
+		return "<="
+	case GT:
+		return ">"
+	case GTE:
+		return ">="
+	}
+	return "?"
+}
+
+func isOrdering(tok Token) bool {
+	return tok == LT || tok == LTE || tok == GT || tok == GTE
+}
+
+func isIdentChar(ch byte) bool {
+	return isLetter(ch) || isDigit(ch) || ch == '_' || ch == '.'
+}
 
-	var tokens []Token
+// item is a token together with its position and, for IDENT, its field name.
+type item struct {
+	tok    Token
+	lit    string
+	pos    int
+	quoted bool
+	sigil  byte
+}
+
+func ParseCondition(input string, opts ...Option) (string, error) {
+	if _, err := parse(NewLexer(input, opts...)); err != nil {
+		return "", err
+	}
+	return input, nil
+}
+
+// Literals returns the literal lexemes of the given kind (NUMBER, STRING,
+// BOOLEAN or NULL) in input, in source order. String literals keep their quotes.
+// Any other kind is an error.
+func Literals(input string, kind Token, opts ...Option) ([]string, error) {
+	if !isLiteral(kind) {
+		return nil, fmt.Errorf("token kind %d is not a literal kind", kind)
+	}
+	tokens, err := parse(NewLexer(input, opts...))
+	if err != nil {
+		return nil, err
+	}
+	var lits []string
+	for _, t := range tokens {
+		if t.tok == kind {
+			lits = append(lits, t.lit)
+		}
+	}
+	return lits, nil
+}
+
+// ReferencedFields returns the distinct fields referenced by input, in order
+// of first use. Names are normalized, so $status, status and `status` are
+// the same field.
+func ReferencedFields(input string, opts ...Option) ([]string, error) {
+	tokens, err := parse(NewLexer(input, opts...))
+	if err != nil {
+		return nil, err
+	}
+	var fields []string
+	seen := make(map[string]bool)
+	for _, t := range tokens {
+		if t.tok == IDENT && !seen[t.lit] {
+			seen[t.lit] = true
+			fields = append(fields, t.lit)
+		}
+	}
+	return fields, nil
+}
+
+// parse lexes the lexer's input and checks that the tokens form a valid
+// condition.
+func parse(l *Lexer) ([]item, error) {
+	tokens, err := tokenize(l)
+	if err != nil {
+		return nil, locateError(l.input, err)
+	}
+	if err := validate(l.code(), tokens, &l.cfg); err != nil {
+		return nil, locateError(l.input, err)
+	}
+	return tokens, nil
+}
+
+func tokenize(l *Lexer) ([]item, error) {
+	var tokens []item
 	for {
 		token := l.NextToken()
 
 		if token == EOF {
 			break
 		}
-		tokens = append(tokens, token)
+		if token == ILLEGAL && l.err != nil {
+			return nil, l.err
+		}
+		tokens = append(tokens, item{tok: token, lit: l.lit, pos: l.start, quoted: l.quoted, sigil: l.sigil})
 	}
+	return tokens, nil
+}
 
+// validate checks that tokens, lexed from input, form a valid condition.
+// input does not include a trailing comment.
+func validate(input string, tokens []item, cfg *config) error {
 	// Check that the tokens form a valid condition
 	if len(tokens) == 0 {
-		return "", fmt.Errorf("Empty condition")
+		return &ValidationError{Code: codeEmptyCondition, Message: "Empty condition"}
+	}
+
+	// Templates that join clauses with AND/OR leave a dangling connective
+	// when one of the clauses renders empty.
+	if first := tokens[0]; first.tok == AND || first.tok == OR {
+		return &ValidationError{
+			Pos:     first.pos,
+			Code:    codeDanglingConnective,
+			Message: fmt.Sprintf("condition begins with a dangling '%s'; a generated clause is probably empty", connective(first.tok)),
+		}
+	}
+	if last := tokens[len(tokens)-1]; last.tok == AND || last.tok == OR {
+		return &ValidationError{
+			Pos:     last.pos,
+			Code:    codeDanglingConnective,
+			Message: fmt.Sprintf("condition ends with a dangling '%s'; a generated clause is probably empty", connective(last.tok)),
+		}
+	}
+
+	// A lone boolean literal is a (constant) condition; a lone field or
+	// other literal is not, as Honeycomb has no implicit truthiness.
+	if len(tokens) == 1 {
+		switch tokens[0].tok {
+		case BOOLEAN:
+			return nil
+		case IDENT:
+			field := strings.TrimSpace(input)
+			return &ValidationError{
+				Pos:     tokens[0].pos,
+				Code:    codeBareField,
+				Message: fmt.Sprintf("%s is a bare field reference; compare it (e.g. %s = \"value\") or use EXISTS(%s)", field, field, field),
+			}
+		case NUMBER, STRING, NULL:
+			literal, field := strings.TrimSpace(input), cfg.suggestSigil(0)+"field"
+			return &ValidationError{
+				Pos:     tokens[0].pos,
+				Code:    codeBareLiteral,
+				Message: fmt.Sprintf("%s is a bare literal, not a condition; compare a field with it (e.g. %s = %s) or use EXISTS(%s)", literal, field, literal, field),
+			}
+		}
+	}
+
+	if tokens[0].tok == REG_MATCH && !followedByField(tokens, 0) {
+		return &ValidationError{Pos: tokens[0].pos, Code: codeRegexWithoutField, Message: "=~ operator must be followed by a field name"}
 	}
 
-	if tokens[0] == NOT {
-		if len(tokens) == 1 {
-			return "", fmt.Errorf("NOT operator must be followed by a condition")
+	// A space ends an unquoted field name, so "$service name" lexes as two
+	// adjacent fields.
+	for i := 1; i < len(tokens); i++ {
+		if tokens[i-1].tok == IDENT && tokens[i].tok == IDENT {
+			name := tokens[i-1].lit + " " + tokens[i].lit
+			return &ValidationError{
+				Pos:     tokens[i].pos - 1,
+				Code:    codeSpaceInFieldName,
+				Message: fmt.Sprintf("field name %q contains a space; quote it with backticks: %s`%s`", name, cfg.suggestSigil(tokens[i-1].sigil), name),
+			}
 		}
-		if tokens[1] == LPAREN {
-			if tokens[len(tokens)-1] != RPAREN {
-				return "", fmt.Errorf("Mismatched parentheses")
+		// Functions take the field as an argument; there is no method
+		// syntax, so $a.LENGTH() is a call on a dotted field name.
+		if prev := tokens[i-1]; prev.tok == IDENT && !prev.quoted && tokens[i].tok == LPAREN && strings.Contains(prev.lit, ".") {
+			dot := strings.LastIndexByte(prev.lit, '.')
+			field, fn := prev.lit[:dot], prev.lit[dot+1:]
+			args := cfg.suggestSigil(prev.sigil) + field
+			if i+1 >= len(tokens) || tokens[i+1].tok != RPAREN {
+				args += ", ..."
+			}
+			return &ValidationError{
+				Pos:     prev.pos,
+				Code:    codePostfixCall,
+				Message: fmt.Sprintf("functions are not called with dot syntax; write %s(%s)", fn, args),
 			}
 		}
-	} else if tokens[0] == LPAREN {
-		if tokens[len(tokens)-1] != RPAREN {
-			return "", fmt.Errorf("Mismatched parentheses")
+		if tokens[i-1].tok == LPAREN && isBinary(tokens[i].tok) {
+			return &ValidationError{
+				Pos:     tokens[i].pos,
+				Code:    codeOperatorAfterParen,
+				Message: fmt.Sprintf("'%s' cannot directly follow '('; expected a value or condition", operatorText(tokens[i].tok)),
+			}
 		}
-	} else if tokens[0] == EXISTS {
-		if len(tokens) == 1 {
-			return "", fmt.Errorf("EXISTS operator must be followed by a field name")
+		if tokens[i-1].tok == RPAREN && tokens[i].tok == LPAREN {
+			return &ValidationError{Pos: tokens[i].pos, Code: codeCallOnGroup, Message: "cannot call a parenthesized expression"}
 		}
-		if tokens[1] != WHITESPACE {
-			return "", fmt.Errorf("EXISTS operator must be followed by a field name")
+		// An empty argument or IN list, or EXISTS(), is reported by the
+		// check for its callee; an empty group has nothing to evaluate.
+		if tokens[i-1].tok == LPAREN && tokens[i].tok == RPAREN && (i < 2 || !isCallee(tokens[i-2]) && tokens[i-2].tok != EXISTS) {
+			return &ValidationError{Pos: tokens[i-1].pos, Code: codeEmptyGroup, Message: "empty parentheses; a group must hold a condition or value"}
 		}
-	} else if tokens[0] == IN {
-		if len(tokens) == 1 {
-			return "", fmt.Errorf("IN operator must be followed by a field name")
+		if isOrdering(tokens[i].tok) && (tokens[i-1].tok == BOOLEAN || i+1 < len(tokens) && tokens[i+1].tok == BOOLEAN) {
+			return &ValidationError{Pos: tokens[i].pos, Code: codeOrderedBoolean, Message: "ordering operator not valid for boolean"}
 		}
-		if tokens[1] != WHITESPACE {
-			return "", fmt.Errorf("IN operator must be followed by a field name")
+	}
+
+	if err := checkParens(input, tokens, cfg); err != nil {
+		return err
+	}
+	if err := checkJoined(tokens); err != nil {
+		return err
+	}
+
+	for i := range tokens {
+		var err error
+		switch tokens[i].tok {
+		case NOT:
+			err = checkNot(tokens, i)
+		case AND, OR:
+			err = checkConnective(tokens, i)
+		case IDENT:
+			err = checkCall(tokens, i)
+		case IN:
+			err = checkIn(tokens, i)
+		case EXISTS:
+			err = checkExists(tokens, i)
+		case COALESCE:
+			err = checkCoalesce(tokens, i)
+		case EQUALS, NOT_EQUALS, REG_MATCH:
+			err = checkOperands(tokens, i)
+		case LT, LTE, GT, GTE:
+			err = checkOperands(tokens, i)
+			if err == nil && !cfg.coerceNumericStrings {
+				if s, ok := numericString(tokens, i); ok {
+					err = &ValidationError{
+						Pos:     s.pos,
+						Code:    codeNumericString,
+						Message: fmt.Sprintf("ordering comparison with the string %s; remove the quotes or pass --coerce-numeric-strings", s.lit),
+					}
+				}
+			}
 		}
-	} else if tokens[0] == REG_MATCH {
-		if len(tokens) == 1 {
-			return "", fmt.Errorf("=~ operator must be followed by a field name")
+		if err != nil {
+			return err
 		}
-		if tokens[1] != WHITESPACE {
-			return "", fmt.Errorf("=~ operator must be followed by a field name")
+	}
+
+	return nil
+}
+
+// checkParens reports the first ')' without a matching '(', or else the
+// innermost '(' that is never closed. It also reports a comma that does
+// not separate the values of an IN list or the arguments of a function
+// call, such as CONCAT($a, $b). Anywhere else a comma would otherwise be
+// skipped, so $a = 1, $b = 2 would pass as two unconnected comparisons.
+// With --numeric-commas, a number such as 1,234 in a list could be one
+// value or two, so it is reported as well.
+func checkParens(input string, tokens []item, cfg *config) error {
+	type group struct {
+		pos  int
+		list bool // holds a list of values or arguments
+	}
+	var open []group
+	for i, t := range tokens {
+		switch t.tok {
+		case LPAREN:
+			open = append(open, group{pos: t.pos, list: i > 0 && isCallee(tokens[i-1])})
+		case RPAREN:
+			if len(open) == 0 {
+				return &ValidationError{Pos: t.pos, Code: codeMismatchedParens, Message: "Mismatched parentheses: ')' has no matching '('"}
+			}
+			open = open[:len(open)-1]
+		case COMMA:
+			if len(open) == 0 || !open[len(open)-1].list {
+				return &ValidationError{Pos: t.pos, Code: codeUnexpectedComma, Message: "unexpected comma"}
+			}
+		case NUMBER:
+			if !cfg.numericCommas || len(open) == 0 || !open[len(open)-1].list {
+				break
+			}
+			end := t.pos + 1
+			for end < len(input) && (isDigit(input[end]) || input[end] == ',') {
+				end++
+			}
+			number := strings.TrimRight(input[t.pos:end], ",")
+			if comma := strings.IndexByte(number, ','); comma >= 0 {
+				return &ValidationError{
+					Pos:     t.pos + comma,
+					Code:    codeAmbiguousComma,
+					Message: fmt.Sprintf("ambiguous comma in %q inside a list; put a space after a comma that separates values, or drop the thousands separators", number),
+				}
+			}
 		}
-	} else if tokens[0] == ILLEGAL {
-		return "", fmt.Errorf("Invalid condition")
 	}
+	if len(open) > 0 {
+		return &ValidationError{Pos: open[len(open)-1].pos, Code: codeMismatchedParens, Message: "Mismatched parentheses: '(' is never closed"}
+	}
+	return nil
+}
 
-	// Check that the tokens form a valid condition
-	if len(tokens) == 0 {
-		return "", fmt.Errorf("Empty condition")
+// checkNot validates that the NOT at tokens[i] is followed by a condition.
+func checkNot(tokens []item, i int) error {
+	if i+1 >= len(tokens) || isBinary(tokens[i+1].tok) || tokens[i+1].tok == RPAREN || tokens[i+1].tok == COMMA {
+		return &ValidationError{Pos: tokens[i].pos, Code: codeNotWithoutCondition, Message: "NOT operator must be followed by a condition"}
 	}
+	return nil
+}
 
-	return input, nil
+// checkConnective validates that the AND or OR at tokens[i] joins two
+// conditions. A connective at either end of the whole condition has
+// already been reported as dangling.
+func checkConnective(tokens []item, i int) error {
+	op := connective(tokens[i].tok)
+	if prev := tokens[i-1].tok; !isOperand(prev) && prev != RPAREN {
+		return &ValidationError{Pos: tokens[i].pos, Code: codeMissingOperand, Message: fmt.Sprintf("'%s' needs a condition on its left", op)}
+	}
+	switch next := tokens[i+1].tok; {
+	case isOperand(next), next == LPAREN, next == NOT, next == EXISTS, next == IN, next == REG_MATCH:
+		return nil
+	}
+	return &ValidationError{Pos: tokens[i].pos, Code: codeMissingOperand, Message: fmt.Sprintf("'%s' needs a condition on its right", op)}
+}
+
+// checkJoined reports a value or condition that directly follows another
+// value or a closed group, as in $a = 1 2, ($a = 1) $b = 2 or
+// $a = 1 NOT $b = 2: the two are missing an AND or OR between them. A
+// field followed by '(' is not a call either, so $status(1) is reported
+// too. Values inside an IN or argument list are checked with their list.
+func checkJoined(tokens []item) error {
+	var lists []bool
+	for i, t := range tokens {
+		joined := i > 0 && (isOperand(tokens[i-1].tok) || tokens[i-1].tok == RPAREN) && (len(lists) == 0 || !lists[len(lists)-1])
+		switch {
+		case t.tok == LPAREN:
+			callee := i > 0 && isCallee(tokens[i-1])
+			if joined && !callee {
+				return &ValidationError{Pos: t.pos, Code: codeMissingConnective, Message: "missing AND or OR; a condition cannot directly follow a value"}
+			}
+			lists = append(lists, callee)
+		case t.tok == RPAREN:
+			lists = lists[:len(lists)-1]
+		case joined && isOperand(t.tok):
+			return &ValidationError{Pos: t.pos, Code: codeMissingConnective, Message: "missing AND or OR; a value cannot directly follow another value or group"}
+		case joined && (t.tok == NOT || t.tok == EXISTS):
+			return &ValidationError{Pos: t.pos, Code: codeMissingConnective, Message: "missing AND or OR; a condition cannot directly follow a value"}
+		}
+	}
+	return nil
+}
+
+// functions maps each function that can be called by name to the fewest
+// arguments it takes. EXISTS and IN are keywords and checked on their own.
+var functions = map[string]int{
+	"IF": 2, "SWITCH": 2, "COALESCE": 1,
+	"LT": 2, "LTE": 2, "GT": 2, "GTE": 2, "EQUALS": 2,
+	"MIN": 1, "MAX": 1, "SUM": 1, "SUB": 2, "MUL": 1, "DIV": 2, "MOD": 2, "LOG10": 1, "BUCKET": 2,
+	"INT": 1, "FLOAT": 1, "BOOL": 1, "STRING": 1,
+	"CONCAT": 1, "STARTS_WITH": 2, "CONTAINS": 2, "TO_LOWER": 1, "LENGTH": 1,
+	"REG_MATCH": 2, "REG_VALUE": 2, "REG_COUNT": 2,
+	"UNIX_TIMESTAMP": 1, "EVENT_TIMESTAMP": 0, "INGEST_TIMESTAMP": 0, "FORMAT_TIME": 2,
+}
+
+// checkCall validates the call at tokens[i], if the bare name there is
+// followed by an argument list: the name must be a known function, given
+// at least as many arguments as it takes.
+func checkCall(tokens []item, i int) error {
+	if !isCallee(tokens[i]) || i+1 >= len(tokens) || tokens[i+1].tok != LPAREN {
+		return nil
+	}
+	name := tokens[i].lit
+	min, ok := functions[name]
+	if !ok {
+		return &ValidationError{Pos: tokens[i].pos, Code: codeUnknownFunction, Message: fmt.Sprintf("unknown function %s", name)}
+	}
+	if n := countArgs(tokens, i+1); n < min {
+		args := "arguments"
+		if min == 1 {
+			args = "argument"
+		}
+		return &ValidationError{Pos: tokens[i].pos, Code: codeTooFewArguments, Message: fmt.Sprintf("%s takes at least %d %s, got %d", name, min, args, n)}
+	}
+	return nil
+}
+
+// countArgs returns the number of arguments in the list opened at
+// tokens[open].
+func countArgs(tokens []item, open int) int {
+	if open+1 < len(tokens) && tokens[open+1].tok == RPAREN {
+		return 0
+	}
+	n, depth := 1, 0
+	for _, t := range tokens[open:] {
+		switch t.tok {
+		case LPAREN:
+			depth++
+		case RPAREN:
+			depth--
+			if depth == 0 {
+				return n
+			}
+		case COMMA:
+			if depth == 1 {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// isCallee reports whether t can be called with a parenthesized argument
+// list: IN, or a bare function name such as CONCAT. A field reference,
+// quoted or with a sigil, cannot be called.
+func isCallee(t item) bool {
+	return t.tok == IN || t.tok == IDENT && !t.quoted && t.sigil == 0
+}
+
+// checkIn validates the IN at tokens[i]. Honeycomb accepts both an infix
+// form, $x IN (1, 2), and a function form, IN($x, 1, 2); which one is meant
+// depends on whether IN has a left operand.
+func checkIn(tokens []item, i int) error {
+	infix := isInfixIn(tokens, i)
+	// $x IN $tags tests membership in an array-valued field. Without a
+	// schema there is no way to check that $tags is an array, so it is
+	// accepted as is.
+	if infix && i+1 < len(tokens) && tokens[i+1].tok == IDENT {
+		return nil
+	}
+	if i+1 >= len(tokens) || tokens[i+1].tok != LPAREN {
+		if infix {
+			return &ValidationError{Pos: tokens[i].pos, Code: codeMalformedIn, Message: "IN must be followed by a parenthesized list of values or an array field, e.g. $x IN (1, 2)"}
+		}
+		return &ValidationError{Pos: tokens[i].pos, Code: codeMalformedIn, Message: "IN must be called with a field and one or more values, e.g. IN($x, 1, 2)"}
+	}
+	values, err := readList(tokens, i+1)
+	if err != nil {
+		return err
+	}
+	if !infix && (len(values) < 2 || values[0].tok != IDENT) {
+		return &ValidationError{Pos: tokens[i].pos, Code: codeMalformedIn, Message: "IN must be called with a field and one or more values, e.g. IN($x, 1, 2)"}
+	}
+	return nil
+}
+
+// checkExists validates the EXISTS at tokens[i]. Literals always exist, so
+// a constant argument is called out separately from a missing field.
+func checkExists(tokens []item, i int) error {
+	if i+2 < len(tokens) && tokens[i+1].tok == LPAREN && isLiteral(tokens[i+2].tok) {
+		return &ValidationError{Pos: tokens[i+2].pos, Code: codeExistsConstant, Message: "EXISTS requires a field, not a constant"}
+	}
+	if !followedByField(tokens, i) {
+		return &ValidationError{Pos: tokens[i].pos, Code: codeExistsWithoutField, Message: "EXISTS operator must be followed by a field name"}
+	}
+
+	// EXISTS yields a boolean, so it can only be compared with true or
+	// false, on either side.
+	end := i + 1
+	if tokens[end].tok == LPAREN {
+		end += 2
+	}
+	var other item
+	switch {
+	case end+2 < len(tokens) && isComparison(tokens[end+1].tok):
+		other = tokens[end+2]
+	case i >= 2 && isComparison(tokens[i-1].tok):
+		other = tokens[i-2]
+	default:
+		return nil
+	}
+	if isLiteral(other.tok) && other.tok != BOOLEAN {
+		return &ValidationError{
+			Pos:     other.pos,
+			Code:    codeExistsComparison,
+			Message: "EXISTS yields a boolean; compare it with true or false, not " + aLiteralKind(other.tok),
+		}
+	}
+	return nil
+}
+
+// checkOperands validates that the comparison at tokens[i] has a value on
+// both sides. The right side may also be a group or a call, as in
+// $flag = EXISTS($a). A leading =~ is the prefix form, =~ $field, which
+// validate has already checked.
+func checkOperands(tokens []item, i int) error {
+	op := operatorText(tokens[i].tok)
+	if i == 0 && tokens[i].tok == REG_MATCH {
+		return nil
+	}
+	if i == 0 || !isOperand(tokens[i-1].tok) && tokens[i-1].tok != RPAREN {
+		return &ValidationError{Pos: tokens[i].pos, Code: codeMissingOperand, Message: fmt.Sprintf("'%s' needs a value on its left", op)}
+	}
+	if i+1 >= len(tokens) {
+		return &ValidationError{Pos: tokens[i].pos, Code: codeMissingOperand, Message: fmt.Sprintf("'%s' needs a value on its right", op)}
+	}
+	switch next := tokens[i+1].tok; {
+	case isOperand(next), next == LPAREN, next == EXISTS, next == IN:
+		return nil
+	}
+	return &ValidationError{Pos: tokens[i].pos, Code: codeMissingOperand, Message: fmt.Sprintf("'%s' needs a value on its right", op)}
+}
+
+// numericString returns the string literal operand of the ordering
+// operator at tokens[i] if it holds a number, as values reconstructed from
+// JSON often do: $duration > "500". Comparing two strings is left alone.
+func numericString(tokens []item, i int) (item, bool) {
+	if i == 0 || i+1 >= len(tokens) {
+		return item{}, false
+	}
+	a, b := tokens[i-1], tokens[i+1]
+	if b.tok == STRING {
+		a, b = b, a
+	}
+	if a.tok != STRING || b.tok == STRING {
+		return item{}, false
+	}
+	s, err := strconv.Unquote(a.lit)
+	if err != nil {
+		return item{}, false
+	}
+	if !decimal.MatchString(s) {
+		return item{}, false
+	}
+	return a, true
+}
+
+// decimal matches a plain decimal number. strconv.ParseFloat also takes
+// NaN, Inf, hex floats and underscores, none of which a query engine
+// coerces from a string.
+var decimal = regexp.MustCompile(`^[+-]?([0-9]+(\.[0-9]*)?|\.[0-9]+)([eE][+-]?[0-9]+)?$`)
+
+// checkCoalesce validates the ?? at tokens[i]. $a ?? 0 is shorthand for
+// COALESCE($a, 0): the left side may be any operand, including a
+// parenthesized group or call, and the right side is the default value.
+func checkCoalesce(tokens []item, i int) error {
+	if i == 0 || !isOperand(tokens[i-1].tok) && tokens[i-1].tok != RPAREN {
+		return &ValidationError{Pos: tokens[i].pos, Code: codeCoalesceOperand, Message: "?? must follow a value"}
+	}
+	if i+1 >= len(tokens) || !isOperand(tokens[i+1].tok) {
+		return &ValidationError{Pos: tokens[i].pos, Code: codeCoalesceOperand, Message: "?? must be followed by a default value"}
+	}
+	return nil
+}
+
+// isInfixIn reports whether the IN at tokens[i] has a left operand.
+func isInfixIn(tokens []item, i int) bool {
+	return i > 0 && (isOperand(tokens[i-1].tok) || tokens[i-1].tok == RPAREN)
+}
+
+// readList returns the elements of the parenthesized, comma-separated list
+// opening at tokens[open].
+func readList(tokens []item, open int) ([]item, error) {
+	var values []item
+	for j := open + 1; j < len(tokens); j++ {
+		if !isOperand(tokens[j].tok) {
+			return nil, &ValidationError{Pos: tokens[j].pos, Code: codeMalformedList, Message: "expected a value in list"}
+		}
+		values = append(values, tokens[j])
+		j++
+		if j >= len(tokens) {
+			break
+		}
+		switch tokens[j].tok {
+		case RPAREN:
+			return values, nil
+		case COMMA:
+		default:
+			return nil, &ValidationError{Pos: tokens[j].pos, Code: codeMalformedList, Message: "expected ',' or ')' in list"}
+		}
+	}
+	return nil, &ValidationError{Pos: tokens[open].pos, Code: codeMalformedList, Message: "unterminated list"}
+}
+
+// followedByField reports whether the operator in tokens[i] is followed by a
+// field name, optionally wrapped in parentheses as in EXISTS($field).
+func followedByField(tokens []item, i int) bool {
+	if len(tokens) > i+1 && tokens[i+1].tok == IDENT {
+		return true
+	}
+	return len(tokens) > i+2 && tokens[i+1].tok == LPAREN && tokens[i+2].tok == IDENT
 }
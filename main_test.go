@@ -0,0 +1,759 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFieldNameCharacters(t *testing.T) {
+	tests := []struct {
+		condition string
+		err       string
+	}{
+		{`$é = 1`, "invalid character 'é' in field name \"é\"; quote it with backticks: $`é`"},
+		{`$a-b = 1`, "invalid character '-' in field name \"a-b\""},
+		{`$service name = "api"`, "field name \"service name\" contains a space; quote it with backticks"},
+		{`$http.method = "GET"`, ""},
+		{"$`service name` = \"api\"", ""},
+	}
+	for _, tt := range tests {
+		_, err := ParseCondition(tt.condition)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("ParseCondition(%q): unexpected error: %v", tt.condition, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("ParseCondition(%q) = %v, want an error containing %q", tt.condition, err, tt.err)
+		}
+	}
+}
+
+// writeFile writes data to name in a fresh temporary directory and returns
+// its path.
+func writeFile(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// run calls Run with args and returns its exit code and output.
+func run(args ...string) (code int, stdout, stderr string) {
+	var out, errOut bytes.Buffer
+	code = Run(args, &out, &errOut)
+	return code, out.String(), errOut.String()
+}
+
+func TestProfiles(t *testing.T) {
+	dir := t.TempDir()
+	cpu, mem := filepath.Join(dir, "cpu.prof"), filepath.Join(dir, "mem.prof")
+	valid := writeFile(t, "valid.txt", `$status = 200`)
+	if code, _, stderr := run("--cpuprofile", cpu, "--memprofile", mem, valid); code != 0 {
+		t.Fatalf("exit code %d; stderr: %s", code, stderr)
+	}
+	for _, path := range []string{cpu, mem} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Errorf("profile not written: %v", err)
+		} else if info.Size() == 0 {
+			t.Errorf("%s is empty", path)
+		}
+	}
+}
+
+// parseTest is a condition and the code of the error ParseCondition should
+// report for it, or "" if it is valid.
+type parseTest struct {
+	condition string
+	code      string
+}
+
+// testParse runs ParseCondition with opts on each of tests.
+func testParse(t *testing.T, tests []parseTest, opts ...Option) {
+	t.Helper()
+	for _, tt := range tests {
+		_, err := ParseCondition(tt.condition, opts...)
+		if got := errorCode(err); got != tt.code || err != nil && tt.code == "" {
+			t.Errorf("ParseCondition(%q) = %v, want code %q", tt.condition, err, tt.code)
+		}
+	}
+}
+
+func TestPlaceholders(t *testing.T) {
+	testParse(t, []parseTest{
+		{`$status = ${STATUS}`, codePlaceholder},
+		{`$env = "${ENV}"`, ""},
+	})
+	testParse(t, []parseTest{
+		{`$status = ${STATUS}`, ""},
+		{`${FIELD} = 1 AND $a IN (${A}, ${B})`, ""},
+		{`$status = ${STATUS`, codeUnterminatedTemplate},
+	}, WithPlaceholders(true))
+}
+
+func TestOrderedBoolean(t *testing.T) {
+	testParse(t, []parseTest{
+		{`true > false`, codeOrderedBoolean},
+		{`$flag >= true`, codeOrderedBoolean},
+		{`false < $flag`, codeOrderedBoolean},
+		{`$flag = true`, ""},
+		{`$flag != false`, ""},
+	})
+}
+
+func TestSingleToken(t *testing.T) {
+	testParse(t, []parseTest{
+		{`$status`, codeBareField},
+		{"`service name`", codeBareField},
+		{`true`, ""},
+		{`false`, ""},
+		{`5`, codeBareLiteral},
+		{`"x"`, codeBareLiteral},
+		{`null`, codeBareLiteral},
+	})
+	_, err := ParseCondition(` 5KB `, WithUnits(true))
+	if want := "5KB is a bare literal, not a condition; compare a field with it (e.g. $field = 5KB) or use EXISTS($field)"; err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("got %v, want %q", err, want)
+	}
+}
+
+func TestIn(t *testing.T) {
+	testParse(t, []parseTest{
+		{`$x IN (1, 2)`, ""},
+		{`$x IN ("a")`, ""},
+		{`IN($x, 1, 2)`, ""},
+		{`IN($x, "a") AND $y = 1`, ""},
+		{`NOT $x IN (1, 2)`, ""},
+		{`$x IN 1`, codeMalformedIn},
+		{`$x IN`, codeMalformedIn},
+		{`IN $x`, codeMalformedIn},
+		{`IN($x)`, codeMalformedIn},
+		{`IN(1, 2)`, codeMalformedIn},
+		{`$x IN ()`, codeMalformedList},
+		{`$x IN (1 2)`, codeMalformedList},
+		{`$x IN (1, AND)`, codeMalformedList},
+	})
+}
+
+func TestLiterals(t *testing.T) {
+	condition := `$a = "x" AND $b IN ("y", 2, "z\"q") OR $c != 3.5 AND $d = true AND $e = null`
+	tests := []struct {
+		kind Token
+		want []string
+	}{
+		{STRING, []string{`"x"`, `"y"`, `"z\"q"`}},
+		{NUMBER, []string{"2", "3.5"}},
+		{BOOLEAN, []string{"true"}},
+		{NULL, []string{"null"}},
+	}
+	for _, tt := range tests {
+		got, err := Literals(condition, tt.kind)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") || len(got) != len(tt.want) {
+			t.Errorf("Literals(%v) = %q, want %q", tt.kind, got, tt.want)
+		}
+	}
+	for _, kind := range []Token{IDENT, AND, ILLEGAL} {
+		if got, err := Literals(condition, kind); err == nil {
+			t.Errorf("Literals(%v) = %q, want an error", kind, got)
+		}
+	}
+	if _, err := Literals(`$a =`, STRING); err == nil {
+		t.Error("Literals of an invalid condition: want an error")
+	}
+}
+
+func TestNumericCommas(t *testing.T) {
+	testParse(t, []parseTest{
+		{`$x > 1,000`, codeUnexpectedComma},
+		{`$x IN (1,000)`, ""},
+	})
+	testParse(t, []parseTest{
+		{`$x > 1,000`, ""},
+		{`$x > -1,000,000.5`, ""},
+		{`$x IN (1, 000, 2)`, ""},
+		{`$x IN (1,000, 2)`, codeAmbiguousComma},
+		{`$x IN (1,234)`, codeAmbiguousComma},
+		{`IF($a, 1,000, 2) > 3`, codeAmbiguousComma},
+		{`($x > 1,000)`, ""},
+		{`$x > 1,00`, codeAmbiguousComma},
+		{`$x > 1000,000`, codeAmbiguousComma},
+	}, WithNumericCommas(true))
+
+	lits, err := Literals(`$x > 1,000 AND $y < 2,500,000`, NUMBER, WithNumericCommas(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(lits, " ") != "1000 2500000" {
+		t.Errorf("got numbers %q, want [1000 2500000]", lits)
+	}
+}
+
+func TestExistsArgument(t *testing.T) {
+	testParse(t, []parseTest{
+		{`EXISTS(5)`, codeExistsConstant},
+		{`EXISTS("x")`, codeExistsConstant},
+		{`EXISTS(null)`, codeExistsConstant},
+		{`EXISTS()`, codeExistsWithoutField},
+		{`EXISTS($field)`, ""},
+		{`EXISTS $field`, ""},
+		{`NOT EXISTS(field)`, ""},
+	})
+}
+
+func TestFailOnWarn(t *testing.T) {
+	warned := writeFile(t, "warned.txt", `NOT NOT $a = 1`)
+	if code, _, _ := run(warned); code != 0 {
+		t.Errorf("warning-only input: exit code %d, want 0", code)
+	}
+	if code, _, _ := run("--fail-on-warn", warned); code != 1 {
+		t.Errorf("warning-only input with --fail-on-warn: exit code %d, want 1", code)
+	}
+	if code, _, _ := run("--fail-on-warn", "--disable", "double-negation", warned); code != 0 {
+		t.Errorf("disabled warning with --fail-on-warn: exit code %d, want 0", code)
+	}
+	for _, rule := range []string{"double-negaton", "HL999", "double-negation,"} {
+		code, _, stderr := run("--disable", rule, warned)
+		if code != 2 || !strings.Contains(stderr, "--disable: unknown warning rule") {
+			t.Errorf("--disable %s: exit code %d, stderr %q, want 2", rule, code, stderr)
+		}
+	}
+}
+
+func TestRunExitCode(t *testing.T) {
+	valid := writeFile(t, "valid.txt", `$status = 200`)
+	invalid := writeFile(t, "invalid.txt", `$status =`)
+
+	tests := []struct {
+		name string
+		args []string
+		code int
+		out  string
+	}{
+		{"valid file", []string{valid}, 0, "Definition in file " + valid + " is valid!"},
+		{"invalid file", []string{invalid}, 1, "Invalid derived column definition"},
+		{"one invalid file fails the run", []string{valid, invalid}, 1, "Invalid derived column definition"},
+		{"missing file", []string{filepath.Join(t.TempDir(), "missing.txt")}, 1, "Error reading file"},
+		{"no arguments", nil, 1, ""},
+		{"help", []string{"-h"}, 0, ""},
+		{"unknown flag", []string{"--no-such-flag", valid}, 1, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, stdout, _ := run(tt.args...)
+			if code != tt.code {
+				t.Errorf("Run(%q) = %d, want %d", tt.args, code, tt.code)
+			}
+			if !strings.Contains(stdout, tt.out) {
+				t.Errorf("Run(%q) printed %q, want it to contain %q", tt.args, stdout, tt.out)
+			}
+		})
+	}
+}
+
+func TestOutputFilters(t *testing.T) {
+	warned := writeFile(t, "warned.txt", `NOT NOT $a = 1`)
+	invalid := writeFile(t, "invalid.txt", `$status =`)
+	const errorLine, warningLine = "Invalid derived column definition", "Warning for derived column definition"
+
+	tests := []struct {
+		flag             string
+		errors, warnings bool
+	}{
+		{"", true, true},
+		{"--only-errors", true, false},
+		{"--only-warnings", false, true},
+	}
+	for _, tt := range tests {
+		args := []string{warned, invalid}
+		if tt.flag != "" {
+			args = append([]string{tt.flag}, args...)
+		}
+		code, stdout, _ := run(args...)
+		if code != 1 {
+			t.Errorf("%s: exit code %d, want 1", tt.flag, code)
+		}
+		if got := strings.Contains(stdout, errorLine); got != tt.errors {
+			t.Errorf("%s: errors printed: %t, want %t\n%s", tt.flag, got, tt.errors, stdout)
+		}
+		if got := strings.Contains(stdout, warningLine); got != tt.warnings {
+			t.Errorf("%s: warnings printed: %t, want %t\n%s", tt.flag, got, tt.warnings, stdout)
+		}
+	}
+
+	if code, _, stderr := run("--only-errors", "--only-warnings", warned); code != 1 || !strings.Contains(stderr, "mutually exclusive") {
+		t.Errorf("both filters: exit code %d, stderr %q", code, stderr)
+	}
+}
+
+func TestDanglingConnective(t *testing.T) {
+	testParse(t, []parseTest{
+		{`AND $a = 1`, codeDanglingConnective},
+		{`OR $a = 1`, codeDanglingConnective},
+		{`$a = 1 AND`, codeDanglingConnective},
+		{`$a = 1 OR `, codeDanglingConnective},
+		{`AND`, codeDanglingConnective},
+		{`$a = 1 AND $b = 2`, ""},
+	})
+	_, err := ParseCondition(`$a = 1 OR`)
+	if want := "condition ends with a dangling 'OR'; a generated clause is probably empty"; err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("got %v, want %q", err, want)
+	}
+}
+
+func TestInArrayField(t *testing.T) {
+	testParse(t, []parseTest{
+		{`$a IN $tags`, ""},
+		{`$user.role IN $admin_roles AND $status = 200`, ""},
+		{`IN $tags`, codeMalformedIn},
+		{`$a IN "tags"`, codeMalformedIn},
+	})
+}
+
+func TestFieldSigil(t *testing.T) {
+	testParse(t, []parseTest{
+		{`@status = 200 AND status != 500`, ""},
+		{"@`service name` = \"api\"", ""},
+		{`$status = 200`, codeUnexpectedCharacter},
+		{`@ = 1`, codeMissingFieldName},
+	}, WithFieldSigil('@'))
+	testParse(t, []parseTest{
+		{`$a = 1 AND @b = 2`, ""},
+	}, WithFieldSigil('$', '@'))
+
+	// Suggested fixes use the sigil the condition is written with.
+	for condition, want := range map[string]string{
+		`@a.LENGTH() > 3`:       "write LENGTH(@a)",
+		`a.LENGTH() > 3`:        "write LENGTH(@a)",
+		`@é = 1`:                "quote it with backticks: @`é`",
+		`@service name = "api"`: "quote it with backticks: @`service name`",
+		`5`:                     "(e.g. @field = 5) or use EXISTS(@field)",
+	} {
+		if _, err := ParseCondition(condition, WithFieldSigil('@', '$')); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ParseCondition(%q) = %v, want %q", condition, err, want)
+		}
+	}
+	if _, err := ParseCondition(`$é = 1`, WithFieldSigil('@', '$')); err == nil || !strings.Contains(err.Error(), "$`é`") {
+		t.Errorf("got %v, want the $ sigil kept", err)
+	}
+
+	if fields, err := ReferencedFields(`@a = 1 AND a = 2`, WithFieldSigil('@')); err != nil || len(fields) != 1 || fields[0] != "a" {
+		t.Errorf("got fields %q, %v; want [a]", fields, err)
+	}
+	for _, sigil := range []string{"a", "(", " ", "`", "-"} {
+		if checkSigils(sigil) == nil {
+			t.Errorf("checkSigils(%q): want an error", sigil)
+		}
+	}
+}
+
+func TestOutputDir(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	if err := os.MkdirAll(filepath.Join("defs", "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		filepath.Join("defs", "a.txt"):        `$a = 1`,
+		filepath.Join("defs", "sub", "b.txt"): `$b =`,
+	}
+	for path, data := range files {
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	code, stdout, stderr := run("--output-dir", "reports", filepath.Join("defs", "a.txt"), filepath.Join("defs", "sub", "b.txt"))
+	if code != 1 {
+		t.Errorf("exit code %d, want 1; stderr: %s", code, stderr)
+	}
+	if stdout != "" {
+		t.Errorf("reports were also printed: %q", stdout)
+	}
+	reports := map[string]string{
+		filepath.Join("reports", "defs", "a.txt.lint.txt"):        "Definition in file " + filepath.Join("defs", "a.txt") + " is valid!",
+		filepath.Join("reports", "defs", "sub", "b.txt.lint.txt"): "'=' needs a value on its right",
+	}
+	for path, want := range reports {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Errorf("report not written: %v", err)
+		} else if !strings.Contains(string(data), want) {
+			t.Errorf("%s: %q does not contain %q", path, data, want)
+		}
+	}
+
+	outside := writeFile(t, "outside.txt", `$a = 1`)
+	rel, err := filepath.Rel(dir, outside)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(rel, "..") {
+		t.Skip("temporary directories are nested")
+	}
+	if code, _, stderr := run("--output-dir", "reports", outside); code != 1 || !strings.Contains(stderr, "outside the working directory") {
+		t.Errorf("input outside the working directory: exit code %d, stderr %q", code, stderr)
+	}
+}
+
+func TestUnits(t *testing.T) {
+	testParse(t, []parseTest{
+		{`$bytes > 1MiB`, codeInvalidNumber},
+	})
+	testParse(t, []parseTest{
+		{`$bytes > 1MiB`, ""},
+		{`$rate >= 2.5k`, ""},
+		{`$bytes > 1XB`, codeUnknownUnit},
+		{`$bytes > 1kb`, codeUnknownUnit},
+	}, WithUnits(true))
+
+	lits, err := Literals(`$a > 1MiB OR $b > 2.5k OR $c > 3 OR $d < 1KB`, NUMBER, WithUnits(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(lits, " "), "1048576 2500 3 1000"; got != want {
+		t.Errorf("got numbers %q, want %q", got, want)
+	}
+	_, err = ParseCondition(`$bytes > 1XB`, WithUnits(true))
+	if want := `unknown unit "XB"; supported units are B, G, GB, GiB,`; err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("got %v, want %q", err, want)
+	}
+}
+
+func TestReferencedFields(t *testing.T) {
+	tests := []struct {
+		condition string
+		want      []string
+	}{
+		{"`status` = 200 AND status != 500 OR $status > 100", []string{"status"}},
+		{`$b = 1 AND EXISTS($a) AND $b IN $c`, []string{"b", "a", "c"}},
+		{"`status ` = 1 AND $status = 2", []string{"status ", "status"}},
+		{`1 = 1`, nil},
+	}
+	for _, tt := range tests {
+		got, err := ReferencedFields(tt.condition)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+			t.Errorf("ReferencedFields(%q) = %q, want %q", tt.condition, got, tt.want)
+		}
+	}
+}
+
+func TestCallOnGroup(t *testing.T) {
+	testParse(t, []parseTest{
+		{`($a)($b)`, codeCallOnGroup},
+		{`($a = 1)($b = 2)`, codeCallOnGroup},
+		{`($a = 1) AND ($b = 2)`, ""},
+		{`NOT ($a = 1)`, ""},
+	})
+}
+
+func TestRuleStats(t *testing.T) {
+	a := writeFile(t, "a.txt", `NOT NOT 1 = 1`)
+	b := writeFile(t, "b.txt", `NOT NOT $a = 1 AND 2 > 1`)
+	c := writeFile(t, "c.txt", `$a = 1`)
+
+	_, stdout, _ := run("--rule-stats", a, b, c)
+	i := strings.Index(stdout, "Rule hits:\n")
+	if i < 0 {
+		t.Fatalf("no rule stats:\n%s", stdout)
+	}
+	want := "Rule hits:\n" +
+		"  constant-comparison      2\n" +
+		"  double-negation          2\n" +
+		"  no-field                 1\n"
+	if got := stdout[i:]; got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	if _, stdout, _ := run("--rule-stats", c); !strings.HasSuffix(stdout, "Rule hits:\n  (none)\n") {
+		t.Errorf("no hits: got\n%s", stdout)
+	}
+}
+
+func TestWildcards(t *testing.T) {
+	testParse(t, []parseTest{
+		{`EXISTS($*)`, codeWildcardNotAllowed},
+		{`$http.* = "x"`, codeWildcardNotAllowed},
+	})
+	testParse(t, []parseTest{
+		{`EXISTS($*)`, ""},
+		{`$http.* = "x"`, ""},
+		{`$http.request.* != null`, ""},
+		{`$.* = 1`, codeInvalidWildcard},
+		{`$http..* = 1`, codeInvalidWildcard},
+		{`$ht*p = 1`, codeInvalidFieldChar},
+	}, WithWildcards(true))
+}
+
+func TestCoalesce(t *testing.T) {
+	testParse(t, []parseTest{
+		{`$a ?? 0`, ""},
+		{`$a ?? 0 > 5`, ""},
+		{`($a) ?? "x" = "x"`, ""},
+		{`$a = 1 AND $b ?? false = true`, ""},
+		{`?? 0`, codeCoalesceOperand},
+		{`$a ??`, codeCoalesceOperand},
+		{`$a ?? $b`, ""},
+		{`$a ?? (1)`, codeCoalesceOperand},
+		{`$a ? 0`, codeUnexpectedCharacter},
+	})
+}
+
+func TestExistsComparison(t *testing.T) {
+	testParse(t, []parseTest{
+		{`EXISTS($a) = true`, ""},
+		{`EXISTS $a != false`, ""},
+		{`false = EXISTS($a)`, ""},
+		{`EXISTS($a) = $b`, ""},
+		{`EXISTS($a) = 1`, codeExistsComparison},
+		{`EXISTS($a) != "true"`, codeExistsComparison},
+		{`null = EXISTS($a)`, codeExistsComparison},
+		{`EXISTS $a > 0`, codeExistsComparison},
+	})
+	_, err := ParseCondition(`EXISTS($a) = 1`)
+	if want := "EXISTS yields a boolean; compare it with true or false, not a number"; err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("got %v, want %q", err, want)
+	}
+}
+
+func TestGroupByRule(t *testing.T) {
+	a := writeFile(t, "a.txt", `NOT NOT $a = 1`)
+	b := writeFile(t, "b.txt", `NOT NOT 1 = 1`)
+	bad := writeFile(t, "bad.txt", `$a =`)
+
+	code, stdout, _ := run("--group-by", "rule", a, b, bad)
+	if code != 1 {
+		t.Errorf("exit code %d, want 1", code)
+	}
+	want := "Invalid definitions (1):\n" +
+		"  " + bad + ": '=' needs a value on its right (at offset 3) [HL038]\n" +
+		"HL104 constant-comparison (1):\n" +
+		"  " + b + ": comparison between two constants is always true (at offset 8)\n" +
+		"HL102 double-negation (2):\n" +
+		"  " + a + ": 2 consecutive NOTs cancel out; remove them (at offset 0)\n" +
+		"  " + b + ": 2 consecutive NOTs cancel out; remove them (at offset 0)\n" +
+		"HL105 no-field (1):\n" +
+		"  " + b + ": condition does not reference any field (at offset 0)\n"
+	if stdout != want {
+		t.Errorf("got\n%s\nwant\n%s", stdout, want)
+	}
+
+	if _, stdout, _ := run("--group-by", "rule", writeFile(t, "ok.txt", `$a = 1`)); stdout != "All definitions are valid!\n" {
+		t.Errorf("all valid: got %q", stdout)
+	}
+	if code, _, stderr := run("--group-by", "rule", "--output-dir", t.TempDir(), a); code != 1 || !strings.Contains(stderr, "cannot be combined") {
+		t.Errorf("with --output-dir: exit code %d, stderr %q", code, stderr)
+	}
+}
+
+func TestPostfixCall(t *testing.T) {
+	testParse(t, []parseTest{
+		{`$a.LENGTH() > 3`, codePostfixCall},
+		{`$a.b.LENGTH() > 3`, codePostfixCall},
+		{`LENGTH($a) > 3`, ""},
+		{`$a.b > 3`, ""},
+	})
+	for condition, want := range map[string]string{
+		`$a.LENGTH() > 3`:            "functions are not called with dot syntax; write LENGTH($a)",
+		`$a.b.SUBSTRING(1, 2) = "x"`: "functions are not called with dot syntax; write SUBSTRING($a.b, ...)",
+	} {
+		if _, err := ParseCondition(condition); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ParseCondition(%q) = %v, want %q", condition, err, want)
+		}
+	}
+}
+
+func TestInlineJSON(t *testing.T) {
+	tests := []struct {
+		json string
+		code int
+		out  string
+	}{
+		{`{"condition": "$a = 1"}`, 0, "Definition in file -e-json is valid!"},
+		{`{"condition": "$a ="}`, 1, "Invalid derived column definition in file -e-json:\n'=' needs a value on its right"},
+		{`{"name": "x"}`, 1, `JSON object has no "condition" field`},
+		{`{"condition": 5}`, 1, `"condition" must be a string, got number`},
+		{`[1]`, 1, "expected a JSON object, got array"},
+		{`{`, 1, "invalid JSON"},
+	}
+	for _, tt := range tests {
+		code, stdout, _ := run("-e-json", tt.json)
+		if code != tt.code || !strings.Contains(stdout, tt.out) {
+			t.Errorf("-e-json %s: exit code %d, output %q; want %d and %q", tt.json, code, stdout, tt.code, tt.out)
+		}
+	}
+
+	file := writeFile(t, "a.txt", `$a =`)
+	code, stdout, _ := run("-e-json", `{"condition": "$a = 1"}`, file)
+	if code != 1 || !strings.HasPrefix(stdout, "Definition in file -e-json is valid!\n") || !strings.Contains(stdout, file) {
+		t.Errorf("with a file: exit code %d, output %q", code, stdout)
+	}
+}
+
+func TestOneline(t *testing.T) {
+	text := writeFile(t, "cond.txt", "$a = 1 AND\n")
+	csv := writeFile(t, "f.csv", "name,condition\na,$a = 1\nb,\"$b = \"\"x\"\" AND\"\nc,\"$c = \"\"y\"\"\n AND $d =\"\n")
+	valid := writeFile(t, "valid.txt", `$a = 1`)
+	warned := writeFile(t, "warned.txt", `NOT NOT $a = 1`)
+
+	tests := []struct {
+		name string
+		args []string
+		code int
+		out  string
+	}{
+		{"text", []string{text}, 1, text + ":1:8: error: condition ends with a dangling 'AND'; a generated clause is probably empty [HL021]\n"},
+		{"csv with doubled quotes", []string{"--format", "csv", "--column", "condition", csv}, 1,
+			csv + ":3:15: error: condition ends with a dangling 'AND'; a generated clause is probably empty [HL021]\n" +
+				csv + ":5:9: error: '=' needs a value on its right [HL038]\n"},
+		{"valid file prints nothing", []string{valid}, 0, ""},
+		{"warning", []string{warned}, 0, warned + ":1:1: warning: 2 consecutive NOTs cancel out; remove them [HL102 double-negation]\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, stdout, stderr := run(append([]string{"--oneline"}, tt.args...)...)
+			if code != tt.code {
+				t.Errorf("exit code %d, want %d; stderr: %s", code, tt.code, stderr)
+			}
+			if stdout != tt.out {
+				t.Errorf("got output\n%s\nwant\n%s", stdout, tt.out)
+			}
+		})
+	}
+}
+
+func TestNumericString(t *testing.T) {
+	testParse(t, []parseTest{
+		{`$duration > "500"`, codeNumericString},
+		{`"1.5" <= $duration`, codeNumericString},
+		{`$duration > 500`, ""},
+		{`$name > "abc"`, ""},
+		{`$name > " 500"`, ""},
+		{`"a" < "500"`, ""},
+		{`$duration = "500"`, ""},
+		{`$duration > "-2.5e3"`, codeNumericString},
+		{`$duration > "NaN"`, ""},
+		{`$duration > "Inf"`, ""},
+		{`$duration > "-infinity"`, ""},
+		{`$duration > "0x1p3"`, ""},
+		{`$duration > "1_000"`, ""},
+	})
+	testParse(t, []parseTest{
+		{`$duration > "500"`, ""},
+	}, WithNumericStringCoercion(true))
+
+	res, err := Lint(`$duration > "500"`, WithNumericStringCoercion(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Warnings) != 1 || res.Warnings[0].Rule != "numeric-string" || res.Warnings[0].Message != `string "500" is compared as the number 500; remove the quotes` {
+		t.Errorf("got warnings %v", res.Warnings)
+	}
+}
+
+func TestStructure(t *testing.T) {
+	tests := []struct {
+		condition string
+		code      string
+		pos       int
+	}{
+		{`($a = 1) AND $b = 2`, "", 0},
+		{`NOT ($a = 1) AND $b = 2`, "", 0},
+		{`(($a = 1) OR $b = 2) AND $c = 3`, "", 0},
+		{`$a = 1 AND ($b = 2`, codeMismatchedParens, 11},
+		{`(($a = 1)`, codeMismatchedParens, 0},
+		{`($a = 1))`, codeMismatchedParens, 8},
+		{`$a = (1`, codeMismatchedParens, 5},
+		{`($= 1)`, codeMissingFieldName, 1},
+		{`(AND $a)`, codeOperatorAfterParen, 1},
+		{`(= 1)`, codeOperatorAfterParen, 1},
+		{`$a = 1 AND (OR $b = 2)`, codeOperatorAfterParen, 12},
+		{`$a =`, codeMissingOperand, 3},
+		{`= 1`, codeMissingOperand, 0},
+		{`$a = 1 AND AND $b = 2`, codeMissingOperand, 7},
+		{`($a = 1 AND) OR $b = 2`, codeMissingOperand, 8},
+		{`$a = 1 AND NOT`, codeNotWithoutCondition, 11},
+		{`NOT`, codeNotWithoutCondition, 0},
+		{`NOT NOT $a = 1`, "", 0},
+		{`()`, codeEmptyGroup, 0},
+		{`( )`, codeEmptyGroup, 0},
+		{`$a = ()`, codeEmptyGroup, 5},
+		{`$a = 1 AND (())`, codeEmptyGroup, 12},
+		{`$a = 1 2`, codeMissingConnective, 7},
+		{`5 5`, codeMissingConnective, 2},
+		{`($a = 1) $b = 2`, codeMissingConnective, 9},
+		{`$x IN (1, 2) AND (($a = 1))`, "", 0},
+	}
+	for _, tt := range tests {
+		_, err := ParseCondition(tt.condition)
+		if tt.code == "" {
+			if err != nil {
+				t.Errorf("ParseCondition(%q): unexpected error: %v", tt.condition, err)
+			}
+			continue
+		}
+		var ve *ValidationError
+		if !errors.As(err, &ve) {
+			t.Errorf("ParseCondition(%q) = %v, want a ValidationError", tt.condition, err)
+			continue
+		}
+		if ve.Code != tt.code || ve.Pos != tt.pos {
+			t.Errorf("ParseCondition(%q) = %v [%s], want %s at offset %d", tt.condition, ve, ve.Code, tt.code, tt.pos)
+		}
+	}
+}
+
+func TestCommas(t *testing.T) {
+	tests := []struct {
+		condition string
+		err       string
+	}{
+		{`$a = 1, $b = 2`, "unexpected comma"},
+		{`($a = 1, $b = 2)`, "unexpected comma"},
+		{`,`, "unexpected comma"},
+		{`$x IN ((1, 2))`, "unexpected comma"},
+		{`$x IN (1, 2)`, ""},
+		{`IN($x, 1, 2)`, ""},
+		{`CONCAT($a, $b) = "x"`, ""},
+		{`STARTS_WITH($path, "/health")`, ""},
+		{`$y = "a,b"`, ""},
+		{`$a(1, 2) = 3`, "unexpected comma"},
+		{`$status(1)`, "missing AND or OR"},
+		{"`a`(1)", "missing AND or OR"},
+		{`FOO($a)`, "unknown function FOO"},
+		{`LENGTH()`, "LENGTH takes at least 1 argument, got 0"},
+		{`LT($a) = true`, "LT takes at least 2 arguments, got 1"},
+		{`IF(LT($a, 1), CONCAT($b, "x"), "y") = "y"`, ""},
+		{`$a = 1 $b = 2`, "missing AND or OR"},
+		{`$a = 1 NOT $b = 2`, "missing AND or OR"},
+		{`$a = 1 EXISTS($b)`, "missing AND or OR"},
+	}
+	for _, tt := range tests {
+		_, err := ParseCondition(tt.condition)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("ParseCondition(%q): unexpected error: %v", tt.condition, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("ParseCondition(%q) = %v, want an error containing %q", tt.condition, err, tt.err)
+		}
+	}
+}
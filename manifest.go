@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// manifest lists the definition files of a repository together with the
+// settings each one needs, so they can all be checked in one run.
+type manifest struct {
+	Files []manifestFile `json:"files"`
+}
+
+// manifestFile is one entry of a manifest. Path is relative to the manifest
+// itself. The remaining fields mirror the command-line flags of the same
+// names and default to the same values.
+type manifestFile struct {
+	Path              string          `json:"path"`
+	Kind              string          `json:"kind"`
+	Format            string          `json:"format"`
+	Column            string          `json:"column"`
+	Header            *bool           `json:"header"`
+	Decode            string          `json:"decode"`
+	AllowPlaceholders bool            `json:"allow_placeholders"`
+	AllowWildcards    bool            `json:"allow_wildcards"`
+	NumericCommas     bool            `json:"numeric_commas"`
+	Units             bool            `json:"units"`
+	CoerceNumeric     bool            `json:"coerce_numeric_strings"`
+	Sigil             string          `json:"sigil"`
+	MaxInItems        *int            `json:"max_in_items"`
+	MaxLength         *int            `json:"max_length"`
+	WarnUnanchored    bool            `json:"warn_unanchored"`
+	Disable           []string        `json:"disable"`
+	Schema            json.RawMessage `json:"schema"`
+}
+
+// readManifest reads and checks the manifest at path, resolving each file's
+// path against the manifest's directory.
+func readManifest(path string) (*manifest, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %v", path, err)
+	}
+	if len(m.Files) == 0 {
+		return nil, fmt.Errorf("manifest %s lists no files", path)
+	}
+	dir := filepath.Dir(path)
+	for i := range m.Files {
+		f := &m.Files[i]
+		if f.Path == "" {
+			return nil, fmt.Errorf("manifest %s: file %d has no path", path, i+1)
+		}
+		if !filepath.IsAbs(f.Path) {
+			f.Path = filepath.Join(dir, f.Path)
+		}
+		switch f.Kind {
+		case "", "condition":
+		case "expression":
+			return nil, fmt.Errorf("manifest %s: %s: expression files are not supported; only conditions can be validated", path, f.Path)
+		default:
+			return nil, fmt.Errorf("manifest %s: %s: unknown kind %q", path, f.Path, f.Kind)
+		}
+		if len(f.Schema) > 0 && string(f.Schema) != "null" {
+			return nil, fmt.Errorf("manifest %s: %s: schemas are not supported", path, f.Path)
+		}
+		switch f.Format {
+		case "", "text", "markdown", "json":
+		case "csv", "tsv":
+			if f.Column == "" {
+				return nil, fmt.Errorf("manifest %s: %s: a column is required for %s input", path, f.Path, f.Format)
+			}
+		default:
+			return nil, fmt.Errorf("manifest %s: %s: unknown format %q", path, f.Path, f.Format)
+		}
+		if err := checkSigils(f.Sigil); err != nil {
+			return nil, fmt.Errorf("manifest %s: %s: %v", path, f.Path, err)
+		}
+		for _, rule := range f.Disable {
+			if err := checkRule(rule); err != nil {
+				return nil, fmt.Errorf("manifest %s: %s: %v", path, f.Path, err)
+			}
+		}
+		if f.Decode != "" && f.Decode != "base64" {
+			return nil, fmt.Errorf("manifest %s: %s: unknown decode encoding %q", path, f.Path, f.Decode)
+		}
+	}
+	return &m, nil
+}
+
+// input returns the inputConfig for f.
+func (f manifestFile) input() inputConfig {
+	in := inputConfig{format: f.Format, column: f.Column, header: true, decode: f.Decode}
+	if in.format == "" {
+		in.format = "text"
+	}
+	if f.Header != nil {
+		in.header = *f.Header
+	}
+	return in
+}
+
+// options returns the parser and lint options for f.
+func (f manifestFile) options() []Option {
+	opts := []Option{
+		WithPlaceholders(f.AllowPlaceholders),
+		WithWildcards(f.AllowWildcards),
+		WithNumericCommas(f.NumericCommas),
+		WithUnits(f.Units),
+		WithNumericStringCoercion(f.CoerceNumeric),
+		WithAnchorCheck(f.WarnUnanchored),
+	}
+	if f.Sigil != "" {
+		opts = append(opts, WithFieldSigil([]byte(f.Sigil)...))
+	}
+	if f.MaxInItems != nil {
+		opts = append(opts, WithMaxInItems(*f.MaxInItems))
+	}
+	if f.MaxLength != nil {
+		opts = append(opts, WithMaxLength(*f.MaxLength))
+	}
+	if len(f.Disable) > 0 {
+		opts = append(opts, WithDisabledRules(f.Disable...))
+	}
+	return opts
+}
+
+// runScan implements the scan subcommand: it validates every file listed in
+// a manifest with that file's own settings.
+func runScan(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("honeycomb-linter scan", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	manifestPath := fs.String("manifest", "", "JSON `file` listing the files to validate and their settings")
+	failOnWarn := fs.Bool("fail-on-warn", false, "exit non-zero if any warning is reported")
+	var out outputConfig
+	fs.StringVar(&out.positionEncoding, "position-encoding", "byte", "how to report positions: byte, utf16 or linecol")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: honeycomb-linter scan --manifest <file>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 1
+	}
+	if *manifestPath == "" || fs.NArg() > 0 {
+		fs.Usage()
+		return 1
+	}
+	switch out.positionEncoding {
+	case "byte", "utf16", "linecol":
+	default:
+		fmt.Fprintf(stderr, "unknown --position-encoding %q\n", out.positionEncoding)
+		return 1
+	}
+
+	m, err := readManifest(*manifestPath)
+	if err != nil {
+		fmt.Fprintln(stderr, "Error reading manifest:", err)
+		return 1
+	}
+	code := 0
+	for _, f := range m.Files {
+		res := lintFile(stdout, f.Path, f.input(), out, f.options()...)
+		if res.errors > 0 || (*failOnWarn && res.warnings > 0) {
+			code = 1
+		}
+	}
+	return code
+}
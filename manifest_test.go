@@ -0,0 +1,62 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScan(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) {
+		t.Helper()
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("plain.txt", `$status = 200`)
+	write("sizes.txt", `$bytes > 1MiB`)
+	write("defs.csv", "name,condition\nbad,$a =\n")
+	write("warned.txt", `NOT NOT $a = 1`)
+	write("manifest.json", `{"files": [
+		{"path": "plain.txt"},
+		{"path": "sizes.txt", "units": true},
+		{"path": "defs.csv", "format": "csv", "column": "condition"},
+		{"path": "warned.txt", "disable": ["double-negation"]}
+	]}`)
+
+	code, stdout, stderr := run("scan", "--manifest", filepath.Join(dir, "manifest.json"))
+	if code != 1 {
+		t.Errorf("exit code %d, want 1; stderr: %s", code, stderr)
+	}
+	for _, name := range []string{"plain.txt", "sizes.txt", "warned.txt"} {
+		if want := "Definition in file " + filepath.Join(dir, name) + " is valid!"; !strings.Contains(stdout, want) {
+			t.Errorf("output does not contain %q:\n%s", want, stdout)
+		}
+	}
+	if !strings.Contains(stdout, "defs.csv (row 2):\n'=' needs a value on its right") {
+		t.Errorf("CSV error not reported:\n%s", stdout)
+	}
+	if strings.Contains(stdout, "Warning") {
+		t.Errorf("disabled rule reported:\n%s", stdout)
+	}
+
+	bad := []struct {
+		manifest string
+		err      string
+	}{
+		{`{"files": []}`, "lists no files"},
+		{`{"files": [{"path": "plain.txt", "kind": "expression"}]}`, "expression files are not supported"},
+		{`{"files": [{"path": "plain.txt", "schema": {}}]}`, "schemas are not supported"},
+		{`{"files": [{"path": "defs.csv", "format": "csv"}]}`, "a column is required for csv input"},
+		{`{"files": [{}]}`, "file 1 has no path"},
+		{`{"files": [{"path": "plain.txt", "disable": ["double-negaton"]}]}`, `unknown warning rule "double-negaton"`},
+	}
+	for _, tt := range bad {
+		write("bad.json", tt.manifest)
+		if code, _, stderr := run("scan", "--manifest", filepath.Join(dir, "bad.json")); code != 1 || !strings.Contains(stderr, tt.err) {
+			t.Errorf("manifest %s: exit code %d, stderr %q, want %q", tt.manifest, code, stderr, tt.err)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// locate converts a byte offset into input to a 1-based line and column,
+// counting columns in characters, and to an offset in UTF-16 code units,
+// which is what LSP clients expect.
+func locate(input string, offset int) (line, column, utf16 int) {
+	if offset > len(input) {
+		offset = len(input)
+	}
+	line, column = 1, 1
+	for _, r := range input[:offset] {
+		if r == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+		if r >= 0x10000 {
+			utf16 += 2
+		} else {
+			utf16++
+		}
+	}
+	return line, column, utf16
+}
+
+// locateError fills in the line, column and UTF-16 offset of a
+// ValidationError from its byte offset into input.
+func locateError(input string, err error) error {
+	var ve *ValidationError
+	if errors.As(err, &ve) {
+		ve.Line, ve.Column, ve.UTF16Pos = locate(input, ve.Pos)
+	}
+	return err
+}
+
+// formatPosition renders a position in the given encoding: "byte" (the
+// default), "utf16" or "linecol".
+func formatPosition(enc string, pos, line, column, utf16 int) string {
+	switch enc {
+	case "utf16":
+		return fmt.Sprintf("at UTF-16 offset %d", utf16)
+	case "linecol":
+		return fmt.Sprintf("at line %d, column %d", line, column)
+	default:
+		return fmt.Sprintf("at offset %d", pos)
+	}
+}
+
+// describeError renders err with its position in the given encoding.
+func describeError(err error, enc string) string {
+	var ve *ValidationError
+	if !errors.As(err, &ve) {
+		return err.Error()
+	}
+	msg := fmt.Sprintf("%s (%s)", ve.Message, formatPosition(enc, ve.Pos, ve.Line, ve.Column, ve.UTF16Pos))
+	if ve.Code != "" {
+		msg += " [" + ve.Code + "]"
+	}
+	return msg
+}
+
+// errorCode returns the code of err, or "" if it has none.
+func errorCode(err error) string {
+	var ve *ValidationError
+	if errors.As(err, &ve) {
+		return ve.Code
+	}
+	return ""
+}
+
+// describeWarning renders w with its position in the given encoding.
+func describeWarning(w Warning, enc string) string {
+	return fmt.Sprintf("%s (%s) [%s %s]", w.Message, formatPosition(enc, w.Pos, w.Line, w.Column, w.UTF16Pos), w.Code, w.Rule)
+}
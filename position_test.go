@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPositions(t *testing.T) {
+	// "é" is 2 bytes and 1 UTF-16 unit, "🙂" is 4 bytes and 2 units.
+	condition := "$a = \"é🙂\"\nAND $b ="
+	_, err := ParseCondition(condition)
+	var ve *ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("got %v, want a ValidationError", err)
+	}
+	if ve.Pos != 21 || ve.UTF16Pos != 18 || ve.Line != 2 || ve.Column != 8 {
+		t.Errorf("got offset %d, UTF-16 offset %d, line %d, column %d; want 21, 18, 2, 8", ve.Pos, ve.UTF16Pos, ve.Line, ve.Column)
+	}
+
+	file := writeFile(t, "cond.txt", condition)
+	for enc, want := range map[string]string{
+		"byte":    "(at offset 21)",
+		"utf16":   "(at UTF-16 offset 18)",
+		"linecol": "(at line 2, column 8)",
+	} {
+		if _, stdout, _ := run("--position-encoding", enc, file); !strings.Contains(stdout, want) {
+			t.Errorf("--position-encoding %s: output %q does not contain %q", enc, stdout, want)
+		}
+	}
+	if code, _, _ := run("--position-encoding", "rune", file); code != 1 {
+		t.Errorf("unknown encoding: exit code %d, want 1", code)
+	}
+}
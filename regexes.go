@@ -0,0 +1,158 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+// regexProbe is a value no sensible pattern is written to match. A pattern
+// that matches both it and the empty string matches every value.
+const regexProbe = "\x00honeylint-probe\x00"
+
+// runRegexes implements the regexes subcommand: it lists every regex
+// pattern in the given files with its position, compiles it and reports patterns
+// that do not compile, match every value, or look like unanchored paths.
+// The exit code is non-zero if a pattern does not compile, or a file or
+// condition cannot be read, as its patterns then go unchecked.
+func runRegexes(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("honeycomb-linter regexes", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	optFlags := addOptionFlags(fs)
+	var in inputConfig
+	fs.StringVar(&in.format, "format", "text", "input `format`: text, csv, tsv, markdown or json")
+	fs.StringVar(&in.column, "column", "", "CSV/TSV `column` holding the conditions")
+	fs.BoolVar(&in.header, "header", true, "treat the first CSV/TSV row as a header")
+	fs.StringVar(&in.decode, "decode", "", "`encoding` of each condition, e.g. base64")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: honeycomb-linter regexes [flags] <filename>...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 1
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return 1
+	}
+	opts, err := optFlags.options()
+	if err != nil {
+		return optionsFailed(stderr, err)
+	}
+	if (in.format == "csv" || in.format == "tsv") && in.column == "" {
+		fmt.Fprintf(stderr, "--column is required for %s input\n", in.format)
+		return 1
+	}
+	code := 0
+	total, failed, skipped := 0, 0, 0
+	for _, definitionFile := range fs.Args() {
+		entries, err := readEntries(definitionFile, in)
+		if err != nil {
+			fmt.Fprintf(stdout, "%s: error reading file: %v\n", definitionFile, err)
+			code = 1
+			continue
+		}
+		for _, e := range entries {
+			where := definitionFile
+			if e.location != "" {
+				where += " (" + e.location + ")"
+			}
+			var condition string
+			var tokens []item
+			err := e.err
+			if err == nil {
+				condition, err = decodeCondition(e.condition, in)
+			}
+			if err == nil {
+				tokens, err = parse(NewLexer(condition, opts...))
+			}
+			if err != nil {
+				fmt.Fprintf(stdout, "%s: skipped, invalid condition: %s\n", where, describeError(err, "byte"))
+				skipped++
+				code = 1
+				continue
+			}
+			for _, lit := range regexPatterns(tokens) {
+				total++
+				status, ok := checkRegex(lit.lit)
+				if !ok {
+					failed++
+					code = 1
+				}
+				fmt.Fprintf(stdout, "%s: offset %d: %s: %s\n", where, lit.pos, lit.lit, status)
+			}
+		}
+	}
+	fmt.Fprintf(stdout, "Patterns checked: %d, invalid: %d, conditions skipped: %d\n", total, failed, skipped)
+	return code
+}
+
+// regexPatterns returns the string literal patterns in tokens: the right
+// side of each =~, and the pattern argument of each REG_MATCH, REG_VALUE
+// or REG_COUNT call, as in REG_MATCH($path, "^/api/"). A pattern given as
+// a field or an expression cannot be checked and is left out.
+func regexPatterns(tokens []item) []item {
+	var patterns []item
+	for i := 0; i+1 < len(tokens); i++ {
+		t := tokens[i]
+		if t.tok == REG_MATCH && tokens[i+1].tok == STRING {
+			patterns = append(patterns, tokens[i+1])
+			continue
+		}
+		if !isCallee(t) || tokens[i+1].tok != LPAREN || t.lit != "REG_MATCH" && t.lit != "REG_VALUE" && t.lit != "REG_COUNT" {
+			continue
+		}
+		// The pattern is the second argument.
+		if j := secondArg(tokens, i+1); j > 0 && j+1 < len(tokens) && tokens[j].tok == STRING && (tokens[j+1].tok == COMMA || tokens[j+1].tok == RPAREN) {
+			patterns = append(patterns, tokens[j])
+		}
+	}
+	return patterns
+}
+
+// secondArg returns the index of the first token of the second argument in
+// the list opened at tokens[open], or -1 if there is none.
+func secondArg(tokens []item, open int) int {
+	depth := 0
+	for j := open; j < len(tokens); j++ {
+		switch tokens[j].tok {
+		case LPAREN:
+			depth++
+		case RPAREN:
+			depth--
+			if depth == 0 {
+				return -1
+			}
+		case COMMA:
+			if depth == 1 {
+				return j + 1
+			}
+		}
+	}
+	return -1
+}
+
+// checkRegex compiles the pattern in the string literal lit and describes
+// it as "ok" or by its problem. ok is false if the pattern does not compile.
+func checkRegex(lit string) (status string, ok bool) {
+	pattern, err := strconv.Unquote(lit)
+	if err != nil {
+		return "invalid string literal", false
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "does not compile: " + err.Error(), false
+	}
+	switch {
+	case re.MatchString("") && re.MatchString(regexProbe):
+		return "broad: matches every value", true
+	case unanchoredPath(pattern):
+		return "unanchored: matches anywhere in the value; anchor it with ^", true
+	}
+	return "ok", true
+}
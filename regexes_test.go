@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegexes(t *testing.T) {
+	good := writeFile(t, "good.txt", `$path =~ "^/api/" AND $method =~ "GET|POST"`)
+	bad := writeFile(t, "bad.txt", `$b > 1KB AND $p =~ "("`)
+	broad := writeFile(t, "broad.txt", `$a =~ ".*" OR $p =~ "/health"`)
+	invalid := writeFile(t, "invalid.txt", `$p =~ "^/x" AND`)
+	calls := writeFile(t, "calls.txt", `REG_MATCH($path, "[") OR REG_VALUE(CONCAT($a, $b), "/x") = "x" OR REG_COUNT($p, $q) > 1`)
+
+	tests := []struct {
+		name string
+		args []string
+		code int
+		out  []string
+	}{
+		{"good", []string{good}, 0, []string{
+			`good.txt: offset 9: "^/api/": ok`,
+			`good.txt: offset 33: "GET|POST": ok`,
+			"Patterns checked: 2, invalid: 0, conditions skipped: 0",
+		}},
+		{"bad pattern", []string{"--units", bad}, 1, []string{
+			`bad.txt: offset 19: "(": does not compile`,
+			"Patterns checked: 1, invalid: 1",
+		}},
+		{"unchecked condition fails", []string{bad}, 1, []string{
+			"bad.txt: skipped, invalid condition",
+			"conditions skipped: 1",
+		}},
+		{"broad and unanchored", []string{broad}, 0, []string{
+			`".*": broad: matches every value`,
+			`"/health": unanchored`,
+		}},
+		{"function patterns", []string{calls}, 1, []string{
+			`calls.txt: offset 17: "[": does not compile`,
+			`calls.txt: offset 51: "/x": unanchored`,
+			"Patterns checked: 2, invalid: 1",
+		}},
+		{"invalid condition", []string{good, invalid}, 1, []string{
+			"Patterns checked: 2, invalid: 0, conditions skipped: 1",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, stdout, stderr := run(append([]string{"regexes"}, tt.args...)...)
+			if code != tt.code {
+				t.Errorf("exit code %d, want %d; stderr: %s", code, tt.code, stderr)
+			}
+			for _, want := range tt.out {
+				if !strings.Contains(stdout, want) {
+					t.Errorf("output %q does not contain %q", stdout, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// The serve subcommand speaks a line protocol for editor plugins. Each line
+// read from stdin is one JSON request:
+//
+//	{"id": 1, "condition": "$status = 200"}
+//
+// and each request gets exactly one JSON response line on stdout, in order:
+//
+//	{"id": 1, "valid": true, "warnings": []}
+//
+// id is echoed back unchanged and may be any JSON value. An invalid
+// condition has "valid": false and an "error" diagnostic. A line that is not
+// a valid request gets a response with a null id and an error diagnostic
+// without a position. The server stops at the end of its input.
+
+// serveRequest is one request line.
+type serveRequest struct {
+	ID        json.RawMessage `json:"id"`
+	Condition string          `json:"condition"`
+}
+
+// serveResponse is one response line.
+type serveResponse struct {
+	ID          json.RawMessage   `json:"id"`
+	Valid       bool              `json:"valid"`
+	Description string            `json:"description,omitempty"`
+	Error       *serveDiagnostic  `json:"error,omitempty"`
+	Warnings    []serveDiagnostic `json:"warnings"`
+}
+
+// serveDiagnostic is an error or warning. Positions are omitted when the
+// problem has none.
+type serveDiagnostic struct {
+	Message     string `json:"message"`
+	Code        string `json:"code,omitempty"`
+	Rule        string `json:"rule,omitempty"`
+	Offset      *int   `json:"offset,omitempty"`
+	Line        int    `json:"line,omitempty"`
+	Column      int    `json:"column,omitempty"`
+	UTF16Offset *int   `json:"utf16_offset,omitempty"`
+}
+
+// maxServeLine bounds the length of a request line.
+const maxServeLine = 1 << 20
+
+// runServe implements the serve subcommand, answering requests from r on
+// stdout until r is exhausted.
+func runServe(args []string, r io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("honeycomb-linter serve", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	optFlags := addOptionFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: honeycomb-linter serve [flags] < requests")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 1
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return 1
+	}
+	opts, err := optFlags.options()
+	if err != nil {
+		return optionsFailed(stderr, err)
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxServeLine)
+	enc := json.NewEncoder(stdout)
+	enc.SetEscapeHTML(false)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+		if err := enc.Encode(serve(line, opts...)); err != nil {
+			fmt.Fprintln(stderr, "Error writing response:", err)
+			return 1
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintln(stderr, "Error reading requests:", err)
+		return 1
+	}
+	return 0
+}
+
+// serve answers a single request line.
+func serve(line []byte, opts ...Option) serveResponse {
+	var req serveRequest
+	if err := json.Unmarshal(line, &req); err != nil {
+		return serveResponse{
+			ID:       json.RawMessage("null"),
+			Error:    &serveDiagnostic{Message: "invalid request: " + err.Error()},
+			Warnings: []serveDiagnostic{},
+		}
+	}
+	resp := serveResponse{ID: req.ID, Warnings: []serveDiagnostic{}}
+	if len(resp.ID) == 0 {
+		resp.ID = json.RawMessage("null")
+	}
+
+	res, err := Lint(req.Condition, opts...)
+	if err != nil {
+		d := serveDiagnostic{Message: err.Error()}
+		var ve *ValidationError
+		if errors.As(err, &ve) {
+			d = serveDiagnostic{Message: ve.Message, Code: ve.Code, Offset: &ve.Pos, Line: ve.Line, Column: ve.Column, UTF16Offset: &ve.UTF16Pos}
+		}
+		resp.Error = &d
+		return resp
+	}
+	resp.Valid = true
+	resp.Description = res.Description
+	for i := range res.Warnings {
+		w := &res.Warnings[i]
+		resp.Warnings = append(resp.Warnings, serveDiagnostic{
+			Message:     w.Message,
+			Code:        w.Code,
+			Rule:        w.Rule,
+			Offset:      &w.Pos,
+			Line:        w.Line,
+			Column:      w.Column,
+			UTF16Offset: &w.UTF16Pos,
+		})
+	}
+	return resp
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestServe(t *testing.T) {
+	requests := strings.Join([]string{
+		`{"id": 1, "condition": "$status = 200"}`,
+		`{"id": "b", "condition": "$status ="}`,
+		``,
+		`{"id": 3, "condition": "$region IN (\"a\", \"b\", \"c\")"}`,
+		`{"id": 4, "condition": "$b > 1KB # big responses"}`,
+		`not json`,
+	}, "\n")
+	var stdout, stderr bytes.Buffer
+	if code := runServe([]string{"--max-in-items", "2", "--units"}, strings.NewReader(requests), &stdout, &stderr); code != 0 {
+		t.Fatalf("runServe = %d; stderr: %s", code, stderr.String())
+	}
+
+	var got []serveResponse
+	dec := json.NewDecoder(&stdout)
+	for dec.More() {
+		var resp serveResponse
+		if err := dec.Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, resp)
+	}
+	if len(got) != 5 {
+		t.Fatalf("got %d responses, want one per non-blank line (5): %+v", len(got), got)
+	}
+
+	if r := got[0]; string(r.ID) != "1" || !r.Valid || r.Error != nil || len(r.Warnings) != 0 {
+		t.Errorf("valid condition: got %+v", r)
+	}
+	if r := got[1]; string(r.ID) != `"b"` || r.Valid || r.Error == nil || r.Error.Code != codeMissingOperand || *r.Error.Offset != 8 || r.Error.Column != 9 {
+		t.Errorf("invalid condition: got %+v, error %+v", r, r.Error)
+	}
+	if r := got[2]; !r.Valid || len(r.Warnings) != 1 || r.Warnings[0].Rule != "in-list-length" || r.Warnings[0].Code != "HL101" {
+		t.Errorf("--max-in-items: got %+v", r)
+	}
+	if r := got[3]; !r.Valid || r.Description != "big responses" {
+		t.Errorf("--units and description: got %+v, error %+v", r, r.Error)
+	}
+	if r := got[4]; string(r.ID) != "null" || r.Valid || r.Error == nil || r.Error.Offset != nil {
+		t.Errorf("malformed request: got %+v", r)
+	}
+}
+
+func TestServeRejectsBadSigil(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := runServe([]string{"--sigil", "="}, strings.NewReader(""), &stdout, &stderr); code != 1 {
+		t.Errorf("runServe with a bad sigil = %d, want 1", code)
+	}
+}
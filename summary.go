@@ -0,0 +1,25 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+)
+
+// summary is the --summary-out artifact: one record per run, meant for
+// tracking lint results over time. Rules counts the hits of each warning
+// rule that fired.
+type summary struct {
+	Files      int            `json:"files"`
+	Passed     int            `json:"passed"`
+	Failed     int            `json:"failed"`
+	Rules      map[string]int `json:"rules"`
+	DurationMS int64          `json:"duration_ms"`
+}
+
+func writeSummary(path string, sum summary) error {
+	data, err := json.MarshalIndent(sum, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestSummary(t *testing.T) {
+	valid := writeFile(t, "valid.txt", `$status = 200`)
+	warned := writeFile(t, "warned.txt", `NOT NOT $a = 1 AND 1 = 1`)
+	invalid := writeFile(t, "invalid.txt", `$status =`)
+	out := filepath.Join(t.TempDir(), "summary.json")
+
+	if code, _, stderr := run("--summary-out", out, valid, warned, invalid); code != 1 {
+		t.Fatalf("exit code %d, want 1; stderr: %s", code, stderr)
+	}
+	data, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sum summary
+	if err := json.Unmarshal(data, &sum); err != nil {
+		t.Fatal(err)
+	}
+	if sum.Files != 3 || sum.Passed != 2 || sum.Failed != 1 {
+		t.Errorf("got files %d, passed %d, failed %d; want 3, 2, 1", sum.Files, sum.Passed, sum.Failed)
+	}
+	want := map[string]int{"double-negation": 1, "constant-comparison": 1}
+	if len(sum.Rules) != len(want) {
+		t.Errorf("got rules %v, want %v", sum.Rules, want)
+	}
+	for rule, n := range want {
+		if sum.Rules[rule] != n {
+			t.Errorf("rule %s: got %d hits, want %d", rule, sum.Rules[rule], n)
+		}
+	}
+	if sum.DurationMS < 0 {
+		t.Errorf("negative duration %d", sum.DurationMS)
+	}
+}